@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goforce/eval"
+	"sort"
+	"strings"
+)
+
+const (
+	CHECK_ERROR   string = "error"
+	CHECK_WARNING string = "warning"
+)
+
+// Check is a data quality rule of a job without target. Condition should evaluate to true for valid records,
+// records failing the condition are written to violations log. Violations of error severity fail the job.
+type Check struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	condition eval.Expr
+}
+
+func (c *Check) init() (err error) {
+	if c.Name == "" {
+		return errors.New("check name should be specified")
+	}
+	if c.Condition == "" {
+		return errors.New(fmt.Sprint("condition of check ", c.Name, " should be specified"))
+	}
+	c.condition, err = eval.ParseString(c.Condition)
+	if err != nil {
+		return errors.New(fmt.Sprint("check ", c.Name, ": ", c.Condition, "\n", err))
+	}
+	c.Severity = strings.ToLower(c.Severity)
+	if c.Severity == "" {
+		c.Severity = CHECK_ERROR
+	}
+	if c.Severity != CHECK_ERROR && c.Severity != CHECK_WARNING {
+		return errors.New(fmt.Sprint("unknown severity of check ", c.Name, ": ", c.Severity, ", expected error or warning"))
+	}
+	if c.Message == "" {
+		c.Message = fmt.Sprint("check ", c.Name, " failed: ", c.Condition)
+	}
+	return nil
+}
+
+// evalChecks returns checks failed by the record evaluated in context.
+func evalChecks(checks []*Check, context eval.Context) ([]*Check, error) {
+	failed := make([]*Check, 0)
+	for _, check := range checks {
+		v, err := check.condition.Eval(context)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("error evaluating check ", check.Name, ": ", err))
+		}
+		ok, isBool := v.(bool)
+		if !isBool {
+			return nil, errors.New(fmt.Sprint("check ", check.Name, " should evaluate to boolean, got: ", v))
+		}
+		if !ok {
+			failed = append(failed, check)
+		}
+	}
+	return failed, nil
+}
+
+// failedChecks returns names of violated checks of the severity
+func failedChecks(violations []*Check, severity string) []string {
+	names := make([]string, 0)
+	for _, check := range violations {
+		if check.Severity == severity {
+			names = append(names, check.Name)
+		}
+	}
+	return names
+}
+
+// verdict counts violations of checks, job fails if any record violates a check of error severity
+// or could not be checked at all.
+type verdict struct {
+	records  int
+	failed   int
+	warnings int
+	errors   int
+	checks   map[string]int
+}
+
+func newVerdict() *verdict {
+	return &verdict{checks: make(map[string]int)}
+}
+
+func (v *verdict) add(violations []*Check) {
+	v.records++
+	failed := false
+	for _, check := range violations {
+		v.checks[check.Name]++
+		if check.Severity == CHECK_ERROR {
+			v.errors++
+			failed = true
+		} else {
+			v.warnings++
+		}
+	}
+	if failed {
+		v.failed++
+	}
+}
+
+// unchecked counts records which checks could not be evaluated for.
+func (v *verdict) unchecked() {
+	v.records++
+	v.failed++
+	v.errors++
+}
+
+func (v *verdict) passed() bool {
+	return v.errors == 0
+}
+
+// summary returns number of violations of each check sorted by check name followed by verdict line.
+func (v *verdict) summary(label string) []string {
+	names := make([]string, 0, len(v.checks))
+	for name := range v.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprint("check ", name, ": ", v.checks[name], " violations"))
+	}
+	result := "PASSED"
+	if !v.passed() {
+		result = "FAILED"
+	}
+	lines = append(lines, fmt.Sprint("checks of job ", label, " ", result, ": ", v.records, " records, ",
+		v.failed, " failed, ", v.errors, " errors, ", v.warnings, " warnings"))
+	return lines
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckInit(t *testing.T) {
+	tests := []struct {
+		check    *Check
+		severity string
+		err      string
+	}{
+		{&Check{Name: "name", Condition: "NOT(ISBLANK(Name))"}, CHECK_ERROR, ""},
+		{&Check{Name: "email", Condition: "NOT(ISBLANK(Email))", Severity: "Warning"}, CHECK_WARNING, ""},
+		{&Check{Name: "email", Condition: "NOT(ISBLANK(Email))", Severity: "fatal"}, "", "unknown severity"},
+		{&Check{Condition: "true"}, "", "name should be specified"},
+		{&Check{Name: "empty"}, "", "condition of check empty"},
+	}
+	for _, test := range tests {
+		err := test.check.init()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Error(test.check.Name, ": expected error ", test.err, ", got: ", err)
+			}
+			continue
+		}
+		if err != nil || test.check.Severity != test.severity || test.check.Message == "" {
+			t.Error(test.check.Name, ": unexpected check: ", test.check, err)
+		}
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	name := &Check{Name: "name", Severity: CHECK_ERROR}
+	email := &Check{Name: "email", Severity: CHECK_WARNING}
+	tests := []struct {
+		records   [][]*Check
+		unchecked int
+		passed    bool
+		summary   string
+	}{
+		{[][]*Check{{}, {}}, 0, true, "PASSED: 2 records, 0 failed, 0 errors, 0 warnings"},
+		// warnings do not fail the job
+		{[][]*Check{{email}, {email}, {}}, 0, true, "PASSED: 3 records, 0 failed, 0 errors, 2 warnings"},
+		{[][]*Check{{name, email}, {email}, {}}, 0, false, "FAILED: 3 records, 1 failed, 1 errors, 2 warnings"},
+		// records which checks could not be evaluated for fail the job
+		{[][]*Check{{}}, 1, false, "FAILED: 2 records, 1 failed, 1 errors, 0 warnings"},
+	}
+	for i, test := range tests {
+		v := newVerdict()
+		for _, violations := range test.records {
+			v.add(violations)
+		}
+		for j := 0; j < test.unchecked; j++ {
+			v.unchecked()
+		}
+		summary := v.summary("accounts")
+		if v.passed() != test.passed || summary[len(summary)-1] != "checks of job accounts "+test.summary {
+			t.Error("#", i, ": unexpected verdict: ", v.passed(), " ", summary)
+		}
+	}
+}
+
+func TestVerdictSummary(t *testing.T) {
+	v := newVerdict()
+	v.add([]*Check{{Name: "name", Severity: CHECK_ERROR}, {Name: "email", Severity: CHECK_WARNING}})
+	v.add([]*Check{{Name: "email", Severity: CHECK_WARNING}})
+	summary := v.summary("accounts")
+	expected := []string{
+		"check email: 2 violations",
+		"check name: 1 violations",
+		"checks of job accounts FAILED: 2 records, 1 failed, 1 errors, 2 warnings",
+	}
+	if strings.Join(summary, "\n") != strings.Join(expected, "\n") {
+		t.Fatal("unexpected summary: ", summary)
+	}
+}
+
+func TestFailedChecks(t *testing.T) {
+	violations := []*Check{{Name: "name", Severity: CHECK_ERROR}, {Name: "email", Severity: CHECK_WARNING}, {Name: "phone", Severity: CHECK_ERROR}}
+	if failed := failedChecks(violations, CHECK_ERROR); strings.Join(failed, ",") != "name,phone" {
+		t.Fatal("unexpected failed checks: ", failed)
+	}
+}
@@ -15,8 +15,8 @@ type Record interface {
 }
 
 type Report interface {
-	Skip()
-	Success(created bool, id string)
+	Skip(reason string)
+	Success(created bool, id string, details ...string)
 	Error(message string)
 	Output(record Record)
 }
@@ -53,6 +53,21 @@ type Writer interface {
 	Close() error
 }
 
+// Prechecker is implemented by writers which could check that target fields can be written before any
+// record is read, so job fails up front instead of failing each record.
+type Prechecker interface {
+	Precheck() error
+}
+
+// AbortError is returned by writers when job should not continue, like when api budget is exhausted.
+type AbortError struct {
+	Message string
+}
+
+func (e *AbortError) Error() string {
+	return e.Message
+}
+
 func GetAllFields(rec Record) []string {
 	var flatten func([]string, Record)
 	fields := make([]string, 0)
@@ -70,3 +85,13 @@ func GetAllFields(rec Record) []string {
 	flatten(make([]string, 0, 5), rec)
 	return fields
 }
+
+// ContainsFold tells if the list contains the string, ignoring case
+func ContainsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
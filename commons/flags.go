@@ -0,0 +1,44 @@
+package commons
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	FLAG_FIELDS_TO_NULL string = "fieldsToNull"
+	FLAG_NULL_IF_BLANK  string = "nullIfBlank"
+	FLAG_TRIM           string = "trim"
+	FLAG_REQUIRED       string = "required"
+	FLAG_INSERT_ONLY    string = "insertOnly"
+	FLAG_FILE_CONTENT   string = "fileContent"
+)
+
+// knownFlags maps lower case flag names including aliases to flag names used by writers
+var knownFlags = map[string]string{
+	"fieldstonull": FLAG_FIELDS_TO_NULL,
+	"nullifblank":  FLAG_NULL_IF_BLANK,
+	"trim":         FLAG_TRIM,
+	"required":     FLAG_REQUIRED,
+	"insertonly":   FLAG_INSERT_ONLY,
+	"noupdate":     FLAG_INSERT_ONLY,
+	"filecontent":  FLAG_FILE_CONTENT,
+}
+
+// ParseFlags parses semicolon separated list of flags. Flag names are case insensitive, unknown flags are rejected.
+func ParseFlags(s string) (map[string]bool, error) {
+	flags := make(map[string]bool)
+	for _, v := range strings.Split(s, ";") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		flag, ok := knownFlags[strings.ToLower(v)]
+		if !ok {
+			return nil, errors.New(fmt.Sprint("unknown flag: ", v))
+		}
+		flags[flag] = true
+	}
+	return flags, nil
+}
@@ -0,0 +1,45 @@
+package commons
+
+// TopologicalOrder orders nodes so that every node comes after the nodes it depends on. Nodes without dependencies
+// between them keep their original order. Nodes which are part of a cycle or depend on one are returned as cyclic
+// in their original order. Dependencies on unknown nodes and on the node itself are ignored.
+func TopologicalOrder(nodes []string, dependsOn map[string][]string) (ordered []string, cyclic []string) {
+	known := make(map[string]bool)
+	for _, n := range nodes {
+		known[n] = true
+	}
+	done := make(map[string]bool)
+	ordered = make([]string, 0, len(nodes))
+	for len(ordered) < len(nodes) {
+		progress := false
+		for _, n := range nodes {
+			if done[n] {
+				continue
+			}
+			ready := true
+			for _, d := range dependsOn[n] {
+				if d != n && known[d] && !done[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[n] = true
+				ordered = append(ordered, n)
+				progress = true
+				// restart to keep original order as much as possible
+				break
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	cyclic = make([]string, 0)
+	for _, n := range nodes {
+		if !done[n] {
+			cyclic = append(cyclic, n)
+		}
+	}
+	return ordered, cyclic
+}
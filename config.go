@@ -6,21 +6,29 @@ import (
 	"github.com/goforce/eval"
 	"github.com/goforce/reloader/commons"
 	"github.com/goforce/reloader/csv"
+	"github.com/goforce/reloader/endpoint"
 	"github.com/goforce/reloader/force"
 	"github.com/goforce/reloader/report"
 	"strings"
 )
 
 type Config struct {
-	Test bool `json:"test"`
-	Logs struct {
+	Test      bool `json:"test"`
+	AutoOrder bool `json:"autoOrder"`
+	Logs      struct {
 		Off   *bool  `json:"off"`
 		Debug string `json:"debug"`
 	} `json:"logs"`
-	Salesforce *force.Salesforce  `json:"salesforce"`
-	Csv        *csv.Csv           `json:"csv"`
-	Lookups    map[string]*Lookup `json:"lookups"`
-	Jobs       []*Job             `json:"jobs"`
+	Salesforce *force.Salesforce `json:"salesforce"`
+	Csv        *csv.Csv          `json:"csv"`
+	Masking    struct {
+		Salt string `json:"salt"`
+	} `json:"masking"`
+	Lookups  map[string]*Lookup  `json:"lookups"`
+	Mappings map[string]*Mapping `json:"mappings"`
+	Samples  []*force.Sample     `json:"samples"`
+	Graph    *force.Graph        `json:"graph"`
+	Jobs     []*Job              `json:"jobs"`
 }
 
 type Lookup struct {
@@ -38,11 +46,17 @@ type Job struct {
 		Salesforce *force.SalesforceSource `json:"salesforce"`
 	} `json:"source"`
 	Target struct {
-		Csv        *csv.CsvTarget          `json:"csv"`
-		Salesforce *force.SalesforceTarget `json:"salesforce"`
+		Csv        *csv.CsvTarget           `json:"csv"`
+		Salesforce *force.SalesforceTarget  `json:"salesforce"`
+		Tree       *force.SalesforceTree    `json:"tree"`
+		Endpoint   *endpoint.EndpointTarget `json:"endpoint"`
 	} `json:"target"`
-	Rules []*Rule     `json:"rules"`
-	Logs  report.Logs `json:"logs"`
+	Rules []*Rule `json:"rules"`
+	// data quality checks of job without target
+	Checks       []*Check    `json:"checks"`
+	Logs         report.Logs `json:"logs"`
+	Transformers int         `json:"transformers"`
+	Salt         string      `json:"salt"`
 }
 
 type Rule struct {
@@ -64,6 +78,7 @@ func (config *Config) ValidateAndCompileConfig(resolver func(string) string) []e
 	// init connector configurations
 	errs.add("salesforce config", config.Salesforce.Init(resolver))
 	errs.add("csv config", config.Csv.Init(resolver))
+	config.Masking.Salt = resolver(config.Masking.Salt)
 	// init lookups
 	for name, lookup := range config.Lookups {
 		location := fmt.Sprint("lookup ", name)
@@ -76,9 +91,20 @@ func (config *Config) ValidateAndCompileConfig(resolver func(string) string) []e
 		errs.add(location, lookup.Source.Salesforce.Init(resolver))
 		errs.add(location, lookup.Source.Csv.Init(resolver))
 	}
+	// init mappings
+	for name, mapping := range config.Mappings {
+		errs.add(fmt.Sprint("mapping ", name), mapping.Init(resolver))
+	}
+	// init samples
+	for i, sample := range config.Samples {
+		errs.add(fmt.Sprint("sample #", i), sample.Init(resolver))
+	}
+	// init graph
+	errs.add("graph", config.Graph.Init(resolver))
 	// init jobs
 	for i, job := range config.Jobs {
 		location := fmt.Sprint("job #", i)
+		job.Salt = resolver(job.Salt)
 		// init source
 		if job.Source.Salesforce == nil && job.Source.Csv == nil {
 			errs.add(location, errors.New("source should be specified"))
@@ -88,12 +114,18 @@ func (config *Config) ValidateAndCompileConfig(resolver func(string) string) []e
 		}
 		errs.add(location, job.Source.Salesforce.Init(resolver))
 		errs.add(location, job.Source.Csv.Init(resolver))
-		// init target
-		if job.Target.Csv == nil && job.Target.Salesforce == nil {
-			errs.add(location, errors.New("target should be specified"))
+		// init target, jobs with checks only validate source and have no target
+		noTarget := job.Target.Csv == nil && job.Target.Salesforce == nil && job.Target.Tree == nil && job.Target.Endpoint == nil
+		if noTarget && len(job.Checks) == 0 {
+			errs.add(location, errors.New("either target or checks should be specified"))
+		}
+		if !noTarget && len(job.Checks) > 0 {
+			errs.add(location, errors.New("checks can be used only in jobs without target"))
 		}
 		errs.add(location, job.Target.Salesforce.Init(resolver))
 		errs.add(location, job.Target.Csv.Init(resolver))
+		errs.add(location, job.Target.Tree.Init(resolver))
+		errs.add(location, job.Target.Endpoint.Init(resolver))
 
 		// parse rules and expressions
 		aliases := make(map[string]bool)
@@ -110,6 +142,39 @@ func (config *Config) ValidateAndCompileConfig(resolver func(string) string) []e
 				errs.add(fmt.Sprint("error in rule of job #", i), errors.New("same alias used more than once:"+alias))
 			}
 			aliases[alias] = true
+			if noTarget && m.Target != "" {
+				errs.add(fmt.Sprint("error in rule of job #", i), errors.New("job without target can not have rule with target: "+m.Target))
+			}
+		}
+		// compile checks
+		checks := make(map[string]bool)
+		for _, c := range job.Checks {
+			errs.add(fmt.Sprint("error in check of job #", i), c.init())
+			if checks[strings.ToUpper(c.Name)] {
+				errs.add(fmt.Sprint("error in check of job #", i), errors.New("same check name used more than once: "+c.Name))
+			}
+			checks[strings.ToUpper(c.Name)] = true
+		}
+		// mappings used by MAP should be configured, otherwise every record would fail
+		expressions := make([]string, 0, len(job.Rules)*3+len(job.Checks))
+		for _, m := range job.Rules {
+			expressions = append(expressions, m.Formula, m.Skip, m.Omit)
+		}
+		for _, c := range job.Checks {
+			expressions = append(expressions, c.Condition)
+		}
+		masking := false
+		for _, expr := range expressions {
+			for _, name := range mappingNames(expr) {
+				if _, ok := config.Mappings[name]; !ok {
+					errs.add(location, errors.New(fmt.Sprint("MAP: no such mapping: ", name)))
+				}
+			}
+			masking = masking || usesMasking(expr)
+		}
+		// values masked without salt could be found by hashing a dictionary of names, emails or phones
+		if masking && job.Salt == "" && config.Masking.Salt == "" {
+			errs.add(location, errors.New("masking functions need salt, set salt of masking or of the job"))
 		}
 	}
 	if len(errs) > 0 {
@@ -119,22 +184,35 @@ func (config *Config) ValidateAndCompileConfig(resolver func(string) string) []e
 }
 
 func (config *Config) SetConfigDefaults() {
-	for _, job := range config.Jobs {
+	for i, job := range config.Jobs {
 		// job label will be used to default log names
 		if job.Label == "" {
 			if job.Target.Csv != nil {
 				job.Label = job.Target.Csv.GetLabel()
 			} else if job.Target.Salesforce != nil {
 				job.Label = job.Target.Salesforce.GetLabel()
+			} else if job.Target.Tree != nil {
+				job.Label = job.Target.Tree.GetLabel()
+			} else if job.Target.Endpoint != nil {
+				job.Label = job.Target.Endpoint.GetLabel()
+			} else {
+				job.Label = fmt.Sprint("checks-", i+1)
 			}
 		}
 		// default logs
 		var truebool bool = true
 		var testbool bool = !config.Test
 		job.Logs.Error.Off = onoff(job.Logs.Error.Off, job.Logs.Off, config.Logs.Off, nil)
-		job.Logs.Success.Off = onoff(job.Logs.Success.Off, job.Logs.Off, config.Logs.Off, &truebool)
+		// success log of jobs without target lists records passing checks, it is written by default
+		successOff := &truebool
+		if len(job.Checks) > 0 {
+			successOff = nil
+		}
+		job.Logs.Success.Off = onoff(job.Logs.Success.Off, job.Logs.Off, config.Logs.Off, successOff)
 		job.Logs.Skip.Off = onoff(job.Logs.Skip.Off, job.Logs.Off, config.Logs.Off, nil)
 		job.Logs.Output.Off = onoff(job.Logs.Output.Off, nil, nil, &testbool)
+		job.Logs.Unmapped.Off = onoff(job.Logs.Unmapped.Off, job.Logs.Off, config.Logs.Off, nil)
+		job.Logs.Violations.Off = onoff(job.Logs.Violations.Off, job.Logs.Off, config.Logs.Off, nil)
 	}
 }
 
@@ -151,11 +229,9 @@ func onoff(logOff *bool, jobOff *bool, topOff *bool, defOff *bool) *bool {
 }
 
 func (m *Rule) parseExpressionsAndFlags() (err error) {
-	m.flags = make(map[string]bool)
-	{
-		for _, v := range strings.Split(m.Flags, ";") {
-			m.flags[v] = true
-		}
+	m.flags, err = commons.ParseFlags(m.Flags)
+	if err != nil {
+		return err
 	}
 	if m.Formula != "" {
 		m.formula, err = eval.ParseString(m.Formula)
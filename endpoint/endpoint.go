@@ -0,0 +1,91 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goforce/eval"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// default timeout of one request in seconds
+const DEFAULT_TIMEOUT int = 60
+
+// EndpointTarget posts each target record as json to http endpoint, like apex rest service.
+// Body is a text template executed with values of target fields, {{json .Name}} writes value of Name as json
+// and {{json (index . "Account.Name")}} could be used for names which are not identifiers. Without body template
+// json object of all target fields is sent.
+type EndpointTarget struct {
+	Url     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// dot separated json paths into response body, like result.id or errors.0.message. Value of success path is
+	// success if it is json true, string "true" in any case or a number other than zero.
+	IdPath      string `json:"idPath"`
+	SuccessPath string `json:"successPath"`
+	ErrorPath   string `json:"errorPath"`
+	// timeout of one request in seconds
+	Timeout  int `json:"timeout"`
+	template *template.Template
+	timeout  time.Duration
+}
+
+func (c *EndpointTarget) Init(resolver func(string) string) (err error) {
+	if c == nil {
+		return
+	}
+	// resolve names
+	c.Url = resolver(c.Url)
+	for k, v := range c.Headers {
+		c.Headers[k] = resolver(v)
+	}
+	// validate
+	if c.Url == "" {
+		return errors.New(fmt.Sprint("url should be specified for endpoint target"))
+	}
+	if u, err := url.Parse(c.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New(fmt.Sprint("url of endpoint target should be http or https url: ", c.Url))
+	}
+	if c.Method == "" {
+		c.Method = "POST"
+	}
+	c.Method = strings.ToUpper(c.Method)
+	if c.Method != "POST" && c.Method != "PUT" && c.Method != "PATCH" {
+		return errors.New(fmt.Sprint("method of endpoint target should be POST, PUT or PATCH: ", c.Method))
+	}
+	if c.Body != "" {
+		c.template, err = template.New("body").Funcs(template.FuncMap{"json": jsonString}).Option("missingkey=error").Parse(c.Body)
+		if err != nil {
+			return errors.New(fmt.Sprint("error parsing body template of endpoint target: ", err))
+		}
+	}
+	if c.Timeout < 0 {
+		return errors.New(fmt.Sprint("timeout of endpoint target should not be negative"))
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DEFAULT_TIMEOUT
+	}
+	c.timeout = time.Duration(c.Timeout) * time.Second
+	return nil
+}
+
+func (c *EndpointTarget) GetLabel() string {
+	if c != nil {
+		if u, err := url.Parse(c.Url); err == nil && u.Host != "" {
+			return u.Host + strings.Replace(strings.TrimSuffix(u.Path, "/"), "/", "-", -1)
+		}
+		return "endpoint"
+	}
+	return ""
+}
+
+func (c *EndpointTarget) NewValuesSupplier() eval.Values {
+	return nil
+}
+
+func (c *EndpointTarget) NewFunctionsSupplier() eval.Functions {
+	return nil
+}
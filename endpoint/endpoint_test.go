@@ -0,0 +1,168 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/goforce/reloader/commons"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testReport struct {
+	success bool
+	created bool
+	id      string
+	details []string
+	err     string
+}
+
+func (r *testReport) Skip(reason string) {}
+
+func (r *testReport) Success(created bool, id string, details ...string) {
+	r.success, r.created, r.id, r.details = true, created, id, details
+}
+
+func (r *testReport) Error(message string) {
+	r.err = message
+}
+
+func (r *testReport) Output(record commons.Record) {}
+
+// newTestEndpoint starts endpoint which creates orders with positive amount, requests are collected by the endpoint
+func newTestEndpoint(requests *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*requests = append(*requests, body)
+		w.Header().Set("Content-Type", "application/json")
+		amount, _ := body["amount"].(json.Number)
+		if f, _ := amount.Float64(); f <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"success":false,"errors":[{"message":"amount should be positive"}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"success":true,"result":{"id":"ORD-` + fmt.Sprint(body["number"]) + `"}}`))
+	}))
+}
+
+func writeOrders(t *testing.T, target *EndpointTarget, rows []map[string]interface{}) []*testReport {
+	if err := target.Init(func(s string) string { return s }); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"Number", "Amount"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := make([]*testReport, 0, len(rows))
+	for _, row := range rows {
+		record := writer.NewRecord()
+		for k, v := range row {
+			record.Set(k, v)
+		}
+		report := &testReport{}
+		reports = append(reports, report)
+		if err := writer.Write(record, report, nil); err != nil {
+			report.Error(err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return reports
+}
+
+func TestEndpointTemplate(t *testing.T) {
+	requests := make([]map[string]interface{}, 0)
+	server := newTestEndpoint(&requests)
+	defer server.Close()
+	target := &EndpointTarget{
+		Url:         server.URL + "/services/apexrest/orders",
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		Body:        `{"number":{{json .Number}},"amount":{{json .Amount}}}`,
+		IdPath:      "result.id",
+		SuccessPath: "success",
+		ErrorPath:   "errors.0.message",
+	}
+	reports := writeOrders(t, target, []map[string]interface{}{
+		{"Number": "1", "Amount": big.NewRat(25, 2)},
+		{"Number": "2", "Amount": big.NewRat(0, 1)},
+	})
+	if !reports[0].success || !reports[0].created || reports[0].id != "ORD-1" || reports[0].details[0] != "status=201" {
+		t.Fatal("unexpected success report: ", reports[0])
+	}
+	if reports[1].success || reports[1].err != "status 400: amount should be positive" {
+		t.Fatal("unexpected error report: ", reports[1])
+	}
+	if len(requests) != 2 || requests[0]["amount"] != json.Number("12.5") {
+		t.Fatal("unexpected requests: ", requests)
+	}
+}
+
+func TestEndpointDefaultBody(t *testing.T) {
+	requests := make([]map[string]interface{}, 0)
+	server := newTestEndpoint(&requests)
+	defer server.Close()
+	target := &EndpointTarget{Url: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	reports := writeOrders(t, target, []map[string]interface{}{{"Number": "3", "Amount": 7}})
+	if len(requests) != 1 || requests[0]["number"] != nil || requests[0]["Number"] != "3" {
+		t.Fatal("unexpected requests: ", requests)
+	}
+	// amount is not found by the endpoint, so request fails with full response body as message
+	if reports[0].success || reports[0].err == "" {
+		t.Fatal("expected error: ", reports[0])
+	}
+	target = &EndpointTarget{Url: server.URL}
+	reports = writeOrders(t, target, []map[string]interface{}{{"Number": "4", "Amount": 1}})
+	if reports[0].success || reports[0].err != "status 401: " {
+		t.Fatal("expected unauthorized error: ", reports[0])
+	}
+}
+
+func TestEndpointRecord(t *testing.T) {
+	target := &EndpointTarget{Url: "https://example.com/orders"}
+	if err := target.Init(func(s string) string { return s }); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"Number", "Amount"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := writer.NewRecord()
+	if _, err := record.Set("number", "5"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := record.Get("Number"); v != "5" {
+		t.Fatal("expected value set case insensitive: ", v)
+	}
+	if _, err := record.Set("Ammount", 1); err == nil || len(record.Fields()) != 2 {
+		t.Fatal("expected error of unknown field: ", err)
+	}
+}
+
+func TestEndpointSuccessPath(t *testing.T) {
+	for value, expected := range map[interface{}]bool{
+		true:               true,
+		false:              false,
+		"TRUE":             true,
+		"yes":              false,
+		json.Number("1"):   true,
+		json.Number("0.0"): false,
+		nil:                false,
+	} {
+		if isTrue(value) != expected {
+			t.Error("success value ", value, " expected ", expected)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EndpointRecord keeps values of target fields as they are set, so they are written to json with their types.
+// Only target fields of the writer could be set, so misspelled targets of rules are not sent unnoticed.
+type EndpointRecord struct {
+	fields []string
+	values map[string]interface{}
+}
+
+func (rec *EndpointRecord) Get(name string) (interface{}, bool) {
+	if k, ok := rec.findName(name); ok {
+		return rec.values[k], true
+	}
+	return nil, false
+}
+
+func (rec *EndpointRecord) Set(name string, value interface{}) (interface{}, error) {
+	k, ok := rec.findName(name)
+	if !ok {
+		return nil, errors.New(fmt.Sprint("no such field in endpoint target: ", name))
+	}
+	rec.values[k] = value
+	return value, nil
+}
+
+func (rec *EndpointRecord) Fields() []string {
+	return rec.fields
+}
+
+func (rec *EndpointRecord) findName(name string) (string, bool) {
+	for _, f := range rec.fields {
+		if strings.EqualFold(f, name) {
+			return f, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,197 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/goforce/eval"
+	"github.com/goforce/reloader/commons"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EndpointWriter struct {
+	target *EndpointTarget
+	client *http.Client
+	fields []string
+	test   bool
+}
+
+func (target *EndpointTarget) NewWriter(fields []string) (commons.Writer, error) {
+	w := &EndpointWriter{target: target, client: &http.Client{Timeout: target.timeout}}
+	w.fields = make([]string, len(fields))
+	copy(w.fields, fields)
+	return w, nil
+}
+
+func (w *EndpointWriter) Fields() []string {
+	return w.fields
+}
+
+func (w *EndpointWriter) SetTest(test bool) {
+	w.test = test
+}
+
+func (w *EndpointWriter) NewRecord() commons.Record {
+	fields := make([]string, len(w.fields))
+	copy(fields, w.fields)
+	return &EndpointRecord{fields: fields, values: make(map[string]interface{})}
+}
+
+// Write sends one request per record, errors of the call are returned to be reported for the record.
+func (w *EndpointWriter) Write(record commons.Record, report commons.Report, context eval.Context) error {
+	report.Output(record)
+	body, err := w.body(record)
+	if err != nil {
+		return err
+	}
+	if w.test {
+		report.Success(false, "")
+		return nil
+	}
+	req, err := http.NewRequest(w.target.Method, w.target.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for k, v := range w.target.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.New(fmt.Sprint("error calling endpoint: ", err))
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.New(fmt.Sprint("error reading response of endpoint: ", err))
+	}
+	w.report(resp.StatusCode, data, report)
+	return nil
+}
+
+// body returns request body built by template or json object of all fields
+func (w *EndpointWriter) body(record commons.Record) ([]byte, error) {
+	values := make(map[string]interface{})
+	for _, f := range record.Fields() {
+		v, _ := record.Get(f)
+		values[f] = jsonValue(v)
+	}
+	if w.target.template == nil {
+		return json.Marshal(values)
+	}
+	var b bytes.Buffer
+	if err := w.target.template.Execute(&b, values); err != nil {
+		return nil, errors.New(fmt.Sprint("error building request body: ", err))
+	}
+	return b.Bytes(), nil
+}
+
+// report maps response to success or error of the record. Response is success if status is 2xx and value of
+// success path, if configured, means success.
+func (w *EndpointWriter) report(status int, data []byte, report commons.Report) {
+	var parsed interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&parsed) != nil {
+		parsed = nil
+	}
+	success := status >= 200 && status < 300
+	if success && w.target.SuccessPath != "" {
+		v, ok := lookup(parsed, w.target.SuccessPath)
+		success = ok && isTrue(v)
+	}
+	text := strings.TrimSpace(string(data))
+	if !success {
+		if v, ok := lookup(parsed, w.target.ErrorPath); w.target.ErrorPath != "" && ok && v != nil {
+			text = fmt.Sprint(v)
+		}
+		report.Error(fmt.Sprint("status ", status, ": ", text))
+		return
+	}
+	details := []string{fmt.Sprint("status=", status)}
+	id := ""
+	if w.target.IdPath != "" {
+		if v, ok := lookup(parsed, w.target.IdPath); ok && v != nil {
+			id = fmt.Sprint(v)
+		}
+	} else if text != "" {
+		details = append(details, "response="+text)
+	}
+	report.Success(status == http.StatusCreated, id, details...)
+}
+
+// isTrue tells if value of success path means success: json true, string "true" or a number other than zero
+func isTrue(value interface{}) bool {
+	switch value.(type) {
+	case bool:
+		return value.(bool)
+	case string:
+		return strings.EqualFold(value.(string), "true")
+	case json.Number:
+		r, ok := new(big.Rat).SetString(value.(json.Number).String())
+		return ok && r.Sign() != 0
+	}
+	return false
+}
+
+// lookup returns value of dot separated path in json value, numbers are indexes of arrays
+func lookup(value interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return value, true
+	}
+	for _, p := range strings.Split(path, ".") {
+		switch value.(type) {
+		case map[string]interface{}:
+			v, ok := value.(map[string]interface{})[p]
+			if !ok {
+				return nil, false
+			}
+			value = v
+		case []interface{}:
+			a := value.([]interface{})
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(a) {
+				return nil, false
+			}
+			value = a[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonValue converts values of expressions to values written to json, decimals are written as exact numbers
+func jsonValue(value interface{}) interface{} {
+	switch value.(type) {
+	case *big.Rat:
+		r := value.(*big.Rat)
+		if r.IsInt() {
+			return json.Number(r.Num().String())
+		}
+		return json.Number(strings.TrimRight(r.FloatString(18), "0"))
+	case time.Time:
+		return value.(time.Time).UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return value
+}
+
+func jsonString(value interface{}) (string, error) {
+	b, err := json.Marshal(jsonValue(value))
+	return string(b), err
+}
+
+func (w *EndpointWriter) Flush() error {
+	return nil
+}
+
+func (w *EndpointWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,116 @@
+package force
+
+import (
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MIN_BATCH_SIZE      int           = 1
+	FAST_BATCH_DURATION time.Duration = 10 * time.Second
+)
+
+// adaptiveSizer keeps batch size and number of workers used by writer in adaptive mode. Batches are shrunk and
+// workers are removed after timeouts and CPU time limit errors, both grow back after fast successful batches.
+type adaptiveSizer struct {
+	lock         sync.Mutex
+	batchSize    int
+	maxBatchSize int
+	workers      int
+	active       int
+	maxWorkers   int
+	closing      bool
+}
+
+func newAdaptiveSizer(batchSize int, maxBatchSize int, workers int, maxWorkers int) *adaptiveSizer {
+	log.Println(commons.PROGRESS, "adaptive mode, batch size: ", batchSize, " workers: ", workers, " max workers: ", maxWorkers)
+	return &adaptiveSizer{batchSize: batchSize, maxBatchSize: maxBatchSize, workers: workers, active: workers, maxWorkers: maxWorkers}
+}
+
+func (a *adaptiveSizer) size() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.batchSize
+}
+
+func (a *adaptiveSizer) shrink(reason string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	batchSize := a.batchSize / 2
+	if batchSize < MIN_BATCH_SIZE {
+		batchSize = MIN_BATCH_SIZE
+	}
+	workers := a.workers - 1
+	if workers < 1 {
+		workers = 1
+	}
+	if batchSize != a.batchSize || workers != a.workers {
+		a.batchSize, a.workers = batchSize, workers
+		log.Println(commons.PROGRESS, "adaptive mode after ", reason, ", batch size: ", a.batchSize, " workers: ", a.workers)
+	}
+}
+
+// grow increases batch size and number of workers, only full batches are taken into account.
+func (a *adaptiveSizer) grow(sent int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if sent < a.batchSize {
+		return
+	}
+	batchSize := a.batchSize + a.batchSize/2 + 1
+	if batchSize > a.maxBatchSize {
+		batchSize = a.maxBatchSize
+	}
+	workers := a.workers + 1
+	if workers > a.maxWorkers {
+		workers = a.maxWorkers
+	}
+	if batchSize != a.batchSize || workers != a.workers {
+		a.batchSize, a.workers = batchSize, workers
+		log.Println(commons.PROGRESS, "adaptive mode after fast batch, batch size: ", a.batchSize, " workers: ", a.workers)
+	}
+}
+
+// returnWorker puts worker back to the pool, drops it or adds more workers to match current number of workers.
+func (a *adaptiveSizer) returnWorker(workers chan *batchWork, batch *batchWork) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !a.closing && a.active > a.workers {
+		a.active--
+		return
+	}
+	workers <- batch
+	for !a.closing && a.active < a.workers {
+		workers <- &batchWork{records: make([]Record, 0, a.batchSize), reports: make([]commons.Report, 0, a.batchSize)}
+		a.active++
+	}
+}
+
+// waitWorkers stops scaling and waits until all active workers are returned to the pool.
+func (a *adaptiveSizer) waitWorkers(workers chan *batchWork) {
+	a.lock.Lock()
+	a.closing = true
+	active := a.active
+	a.lock.Unlock()
+	for i := 0; i < active; i++ {
+		<-workers
+	}
+}
+
+func isTimeout(err error) bool {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	s := strings.ToLower(fmt.Sprint(err))
+	return strings.Contains(s, "timeout") || strings.Contains(s, "timed out")
+}
+
+func isCpuTimeLimit(message string) bool {
+	return strings.Contains(strings.ToLower(message), "cpu time limit")
+}
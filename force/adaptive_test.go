@@ -0,0 +1,78 @@
+package force
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAdaptiveShrink(t *testing.T) {
+	a := newAdaptiveSizer(200, MAX_BATCH_SIZE, 3, 5)
+	a.shrink("timeout")
+	if a.size() != 100 || a.workers != 2 {
+		t.Fatal("unexpected size after shrink: ", a.size(), " workers: ", a.workers)
+	}
+	for i := 0; i < 10; i++ {
+		a.shrink("CPU time limit")
+	}
+	if a.size() != MIN_BATCH_SIZE || a.workers != 1 {
+		t.Fatal("expected shrink down to minimum, got: ", a.size(), " workers: ", a.workers)
+	}
+}
+
+func TestAdaptiveGrow(t *testing.T) {
+	a := newAdaptiveSizer(10, 50, 1, 3)
+	// batches not filled do not tell if bigger batch would be fast
+	a.grow(5)
+	if a.size() != 10 || a.workers != 1 {
+		t.Fatal("expected no growth after partial batch, got: ", a.size(), " workers: ", a.workers)
+	}
+	a.grow(10)
+	if a.size() != 16 || a.workers != 2 {
+		t.Fatal("unexpected size after grow: ", a.size(), " workers: ", a.workers)
+	}
+	for i := 0; i < 10; i++ {
+		a.grow(a.size())
+	}
+	if a.size() != 50 || a.workers != 3 {
+		t.Fatal("expected growth up to maximum, got: ", a.size(), " workers: ", a.workers)
+	}
+}
+
+func TestAdaptiveWorkers(t *testing.T) {
+	a := newAdaptiveSizer(10, MAX_BATCH_SIZE, 2, 4)
+	workers := make(chan *batchWork, 4)
+	workers <- &batchWork{}
+	workers <- &batchWork{}
+	// returned worker brings new ones up to the grown number of workers
+	a.grow(10)
+	a.returnWorker(workers, <-workers)
+	if len(workers) != 3 || a.active != 3 {
+		t.Fatal("expected three workers, got: ", len(workers), " active: ", a.active)
+	}
+	// extra workers are dropped when they are returned after shrink
+	a.shrink("timeout")
+	a.shrink("timeout")
+	taken := []*batchWork{<-workers, <-workers, <-workers}
+	for _, batch := range taken {
+		a.returnWorker(workers, batch)
+	}
+	if len(workers) != 1 || a.active != 1 {
+		t.Fatal("expected one worker, got: ", len(workers), " active: ", a.active)
+	}
+	a.waitWorkers(workers)
+	if len(workers) != 0 {
+		t.Fatal("expected active workers taken from pool")
+	}
+}
+
+func TestAdaptiveErrors(t *testing.T) {
+	if !isTimeout(errors.New("Post https://example.com: net/http: request canceled (Client.Timeout exceeded)")) || !isTimeout(errors.New("read tcp: i/o timeout")) {
+		t.Fatal("expected timeout")
+	}
+	if isTimeout(errors.New("INVALID_FIELD: no such column")) {
+		t.Fatal("unexpected timeout")
+	}
+	if !isCpuTimeLimit("System.LimitException: Apex CPU time limit exceeded") || isCpuTimeLimit("REQUIRED_FIELD_MISSING") {
+		t.Fatal("unexpected CPU time limit detection")
+	}
+}
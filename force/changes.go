@@ -0,0 +1,241 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// topLevelFields returns distinct names of fields as they are set in the record,
+// nested fields like Account:Account.ExtId__c are reduced to relationship name.
+func topLevelFields(fields []string) []string {
+	top := make([]string, 0, len(fields))
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		name := strings.Split(strings.Split(f, ".")[0], ":")[0]
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			top = append(top, name)
+		}
+	}
+	return top
+}
+
+// matchKey returns name of the field used to match records against existing ones in salesforce.
+func (writer *ForceWriter) matchKey() string {
+	if writer.operation == "UPSERT" {
+		return writer.externalId
+	}
+	return "Id"
+}
+
+// keyValue normalizes value of match key, ids are compared by 15 chars and external ids are case insensitive.
+func keyValue(key string, value interface{}) string {
+	s := String(value)
+	if strings.EqualFold(key, "Id") {
+		if len(s) > 15 {
+			s = s[:15]
+		}
+		return s
+	}
+	return strings.ToLower(s)
+}
+
+// fetchCurrent queries current values of fields for the records in batch. Returned map is keyed by match key value.
+func (writer *ForceWriter) fetchCurrent(records []Record, fields []string) (map[string]Record, error) {
+	key := writer.matchKey()
+	values := make([]string, 0, len(records))
+	for _, record := range records {
+		if v, ok := record.Get(key); ok && v != nil && String(v) != "" {
+			values = append(values, "'"+escapeSoql(String(v))+"'")
+		}
+	}
+	current := make(map[string]Record)
+	if len(values) == 0 {
+		return current, nil
+	}
+	selected := []string{"Id"}
+	if !strings.EqualFold(key, "Id") {
+		selected = append(selected, key)
+	}
+	for _, f := range fields {
+		if !strings.EqualFold(f, "Id") && !strings.EqualFold(f, key) {
+			selected = append(selected, f)
+		}
+	}
+	soql := fmt.Sprint("select ", strings.Join(selected, ","), " from ", writer.sObjectDescribe.Name,
+		" where ", key, " in (", strings.Join(values, ","), ")")
+	found, err := readAll(writer.instance.connection.Query(soql))
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error fetching current values: ", err))
+	}
+	for _, record := range found {
+		if v, ok := record.Get(key); ok {
+			current[keyValue(key, v)] = record
+		}
+	}
+	return current, nil
+}
+
+// removeUnchanged compares records in batch with their current values in salesforce. Records without changes are
+// reported as skipped and removed, others are replaced with records containing match key and changed fields only.
+func (writer *ForceWriter) removeUnchanged(records []Record, reports []commons.Report) ([]Record, []commons.Report) {
+	key := writer.matchKey()
+	compared := make([]string, 0, len(writer.topFields))
+	for _, f := range writer.topFields {
+		if _, nested := writer.nestedFields[f]; !nested && writer.sObjectDescribe.Get(f) != nil {
+			compared = append(compared, writer.sObjectDescribe.Get(f).Name)
+		}
+	}
+	current, err := writer.fetchCurrent(records, compared)
+	if err != nil {
+		log.Println(commons.ERRORS, err)
+		panic("error calling salesforce api")
+	}
+	insertOnly := make(map[string]bool)
+	for _, f := range writer.insertOnlyFields() {
+		insertOnly[strings.ToLower(f)] = true
+	}
+	changedRecords := make([]Record, 0, len(records))
+	changedReports := make([]commons.Report, 0, len(reports))
+	for i, record := range records {
+		k, _ := record.Get(key)
+		existing, ok := current[keyValue(key, k)]
+		if !ok {
+			// new or missing record, let salesforce decide
+			changedRecords = append(changedRecords, record)
+			changedReports = append(changedReports, reports[i])
+			continue
+		}
+		present := presentFields(record)
+		changed := make([]string, 0, len(writer.topFields))
+		for _, f := range writer.topFields {
+			if strings.EqualFold(f, key) || !present[strings.ToLower(f)] || insertOnly[strings.ToLower(f)] {
+				continue
+			}
+			if _, nested := writer.nestedFields[f]; nested {
+				// references by external id can not be compared, always send them
+				changed = append(changed, f)
+				continue
+			}
+			fd := writer.sObjectDescribe.Get(f)
+			if fd == nil {
+				continue
+			}
+			newValue, _ := record.Get(f)
+			oldValue, _ := existing.Get(fd.Name)
+			if normalize(fd, newValue) != normalize(fd, oldValue) {
+				changed = append(changed, f)
+			}
+		}
+		if len(changed) == 0 {
+			reports[i].Skip("no changes")
+			continue
+		}
+		diff, err := writer.copyRecord(record, append(changed, key))
+		if err != nil {
+			reports[i].Error(err.Error())
+			continue
+		}
+		changedRecords = append(changedRecords, diff)
+		changedReports = append(changedReports, reports[i])
+	}
+	return changedRecords, changedReports
+}
+
+// copyRecord creates new record of target sObject with values of listed fields copied from record.
+func (writer *ForceWriter) copyRecord(record Record, fields []string) (Record, error) {
+	var copied Record
+	var err error
+	if writer.operation == "CONVERTLEAD" {
+		copied = newMapRecord()
+	} else if copied, err = NewDescribedRecord(writer.sObjectDescribe); err != nil {
+		return nil, err
+	}
+	present := presentFields(record)
+	for _, f := range fields {
+		if !present[strings.ToLower(f)] {
+			continue
+		}
+		if v, ok := record.Get(f); ok {
+			if _, err := copied.Set(f, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return copied, nil
+}
+
+// presentFields returns lower case top level names of the fields set in record.
+func presentFields(record Record) map[string]bool {
+	present := make(map[string]bool)
+	for _, f := range topLevelFields(record.Fields()) {
+		present[strings.ToLower(f)] = true
+	}
+	return present
+}
+
+// normalize converts value to string representation which could be compared regardless of the type returned by
+// salesforce or produced by rules.
+func normalize(fd *FieldDescribe, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if t, ok := value.(time.Time); ok {
+		switch fd.Type {
+		case "date":
+			return t.Format("2006-01-02")
+		case "time":
+			return t.Format("15:04:05.000")
+		default:
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	s := String(value)
+	if s == "" {
+		return ""
+	}
+	switch fd.Type {
+	case "int", "double", "currency", "percent":
+		if r, ok := new(big.Rat).SetString(strings.TrimSpace(s)); ok {
+			return r.RatString()
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return strconv.FormatBool(b)
+		}
+	case "date":
+		for _, layout := range []string{"2006-01-02", time.RFC3339} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.Format("2006-01-02")
+			}
+		}
+	case "datetime":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.000Z0700", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC().Format(time.RFC3339)
+			}
+		}
+	case "id", "reference":
+		if len(s) > 15 {
+			return s[:15]
+		}
+	case "multipicklist":
+		values := strings.Split(s, ";")
+		sort.Strings(values)
+		return strings.Join(values, ";")
+	}
+	return s
+}
+
+func escapeSoql(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	return strings.Replace(s, "'", "\\'", -1)
+}
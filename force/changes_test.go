@@ -0,0 +1,41 @@
+package force
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestOnlyChanged(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	accounts := server.Records("Account")
+	fields := []string{"Id", "Name", "AnnualRevenue", "Active__c", "Since__c"}
+	target := &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UPDATE"}
+	write(t, target, fields, []map[string]interface{}{
+		{"Id": accounts[0]["Id"], "AnnualRevenue": "1000000", "Active__c": "true", "Since__c": "2015-03-01"},
+		{"Id": accounts[1]["Id"], "AnnualRevenue": "2500"},
+	})
+	updates := server.Calls("update")
+	// values of other types equal to current ones are not changes, blank is the same as null
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UPDATE", OnlyChanged: true}
+	reports := write(t, target, append(fields, "Type"), []map[string]interface{}{
+		{"Id": accounts[0]["Id"] + "AAA", "Name": "Acme", "AnnualRevenue": big.NewRat(1000000, 1), "Active__c": true,
+			"Since__c": time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC), "Type": "Customer"},
+		{"Id": accounts[1]["Id"], "Name": "Globex", "AnnualRevenue": "2500.00", "Active__c": "", "Since__c": nil, "Type": "Customer"},
+	})
+	if reports[0].skipped != "no changes" {
+		t.Fatal("expected unchanged record skipped: ", reports[0].skipped, reports[0].err)
+	}
+	if !reports[1].success {
+		t.Fatal("expected changed record updated: ", reports[1].err)
+	}
+	if server.Calls("update") != updates+1 {
+		t.Fatal("expected one update call, got: ", server.Calls("update")-updates)
+	}
+	// only changed fields are sent, unchanged revenue keeps its current form
+	globex := server.Records("Account")[1]
+	if globex["Type"] != "Customer" || globex["AnnualRevenue"] != "2500" {
+		t.Fatal("unexpected account: ", globex)
+	}
+}
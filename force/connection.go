@@ -0,0 +1,134 @@
+package force
+
+import (
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/api/soap"
+	"io"
+)
+
+// Connection is salesforce api used by readers, writers and lookups. It is implemented over soap and rest apis,
+// api is selected per instance.
+type Connection interface {
+	Query(soql string) (QueryCursor, error)
+	// QueryAll queries deleted and archived records too
+	QueryAll(soql string) (QueryCursor, error)
+	DescribeSObject(name string) (*DescribeSObjectResult, error)
+	Insert(sObject string, records []Record) ([]DmlResult, error)
+	Update(sObject string, records []Record) ([]DmlResult, error)
+	Upsert(sObject string, records []Record, externalId string) ([]DmlResult, error)
+	Delete(records []Record) ([]DmlResult, error)
+}
+
+// QueryCursor reads records of query result, io.EOF is returned after the last record.
+type QueryCursor interface {
+	Read() (Record, error)
+}
+
+type DmlResult struct {
+	Success bool
+	Created bool
+	Id      string
+	Message string
+	// written to success log along with id
+	Details []string
+}
+
+// SOAP_QUERY_BATCH_SIZE is number of records returned by soap query and each queryMore call
+const SOAP_QUERY_BATCH_SIZE int = 500
+
+// soapConnection counts calls of the api. Calls done by query reader to read more records are counted
+// by records read, one call for each batch of SOAP_QUERY_BATCH_SIZE records.
+type soapConnection struct {
+	connection *soap.Connection
+	usage      *apiUsage
+	session    func() (*session, error)
+}
+
+func (c *soapConnection) Query(soql string) (QueryCursor, error) {
+	c.usage.count()
+	reader, err := NewReader(c.connection.Query(soql))
+	if err != nil {
+		return nil, err
+	}
+	return &countingCursor{cursor: reader, usage: c.usage}, nil
+}
+
+// countingCursor counts queryMore calls done by soap query reader
+type countingCursor struct {
+	cursor QueryCursor
+	usage  *apiUsage
+	read   int
+}
+
+func (c *countingCursor) Read() (Record, error) {
+	record, err := c.cursor.Read()
+	if err == nil {
+		c.read++
+		if c.read > SOAP_QUERY_BATCH_SIZE && c.read%SOAP_QUERY_BATCH_SIZE == 1 {
+			c.usage.count()
+		}
+	}
+	return record, err
+}
+
+// QueryAll is read through rest api as soap connection supports only query
+func (c *soapConnection) QueryAll(soql string) (QueryCursor, error) {
+	s, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	return newRestConnection(c, s).QueryAll(soql)
+}
+
+func (c *soapConnection) DescribeSObject(name string) (*DescribeSObjectResult, error) {
+	c.usage.count()
+	return c.connection.DescribeSObject(name)
+}
+
+func (c *soapConnection) Insert(sObject string, records []Record) ([]DmlResult, error) {
+	c.usage.count()
+	return soapResults(c.connection.Insert(records))
+}
+
+func (c *soapConnection) Update(sObject string, records []Record) ([]DmlResult, error) {
+	c.usage.count()
+	return soapResults(c.connection.Update(records))
+}
+
+func (c *soapConnection) Upsert(sObject string, records []Record, externalId string) ([]DmlResult, error) {
+	c.usage.count()
+	return soapResults(c.connection.Upsert(records, externalId))
+}
+
+func (c *soapConnection) Delete(records []Record) ([]DmlResult, error) {
+	c.usage.count()
+	return soapResults(c.connection.Delete(records))
+}
+
+func soapResults(results []soap.DmlResult, err error) ([]DmlResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]DmlResult, len(results))
+	for i, r := range results {
+		converted[i] = DmlResult{Success: r.Success, Created: r.Created, Id: r.Id, Message: r.Errors.Message}
+	}
+	return converted, nil
+}
+
+// readAll reads all records of the query
+func readAll(cursor QueryCursor, err error) ([]Record, error) {
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0)
+	for {
+		record, err := cursor.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
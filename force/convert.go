@@ -0,0 +1,98 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/reloader/commons"
+	"strings"
+)
+
+// maximum number of leads converted by one convertLead call
+const MAX_CONVERT_BATCH_SIZE int = 100
+
+// target fields of CONVERTLEAD operation in the order of LeadConvert type of partner api
+var convertFields = []string{
+	"AccountId",
+	"ContactId",
+	"ConvertedStatus",
+	"DoNotCreateOpportunity",
+	"LeadId",
+	"OpportunityName",
+	"OverwriteLeadSource",
+	"OwnerId",
+	"SendNotificationEmail",
+}
+
+// validateConvertFields checks that all target fields are arguments of lead conversion
+func validateConvertFields(fields []string) error {
+	for _, f := range fields {
+		if !commons.ContainsFold(convertFields, f) {
+			return errors.New(fmt.Sprint("unknown field of CONVERTLEAD operation: ", f, ", expected one of: ", strings.Join(convertFields, ", ")))
+		}
+	}
+	return nil
+}
+
+// validateConvert checks that lead and its converted status are specified
+func validateConvert(record Record) error {
+	for _, f := range []string{"LeadId", "ConvertedStatus"} {
+		if v, _ := record.Get(f); v == nil || strings.TrimSpace(String(v)) == "" {
+			return errors.New(fmt.Sprint(f, " should be specified to convert lead"))
+		}
+	}
+	return nil
+}
+
+// convertLeads converts leads using soap api, results have Id of the lead and Ids of account, contact and
+// opportunity as details.
+func (writer *ForceWriter) convertLeads(records []Record) ([]DmlResult, error) {
+	s, err := writer.instance.restSession()
+	if err != nil {
+		return nil, err
+	}
+	var body strings.Builder
+	body.WriteString("<urn:convertLead>")
+	for _, record := range records {
+		body.WriteString("<urn:leadConverts>")
+		for _, f := range convertFields {
+			v, _ := record.Get(f)
+			if v == nil || String(v) == "" {
+				continue
+			}
+			var fd *FieldDescribe
+			if f == "DoNotCreateOpportunity" || f == "OverwriteLeadSource" || f == "SendNotificationEmail" {
+				fd = &FieldDescribe{Type: "boolean"}
+			}
+			name := strings.ToLower(f[:1]) + f[1:]
+			body.WriteString("<urn:" + name + ">" + escapeXml(fmt.Sprint(jsonValue(fd, v))) + "</urn:" + name + ">")
+		}
+		body.WriteString("</urn:leadConverts>")
+	}
+	body.WriteString("</urn:convertLead>")
+	var response struct {
+		Results []struct {
+			Success       bool        `xml:"success"`
+			LeadId        string      `xml:"leadId"`
+			AccountId     string      `xml:"accountId"`
+			ContactId     string      `xml:"contactId"`
+			OpportunityId string      `xml:"opportunityId"`
+			Errors        []soapError `xml:"errors"`
+		} `xml:"convertLeadResponse>result"`
+	}
+	if err := s.soap("convertLead", body.String(), &response); err != nil {
+		return nil, err
+	}
+	results := make([]DmlResult, len(response.Results))
+	for i, r := range response.Results {
+		results[i] = DmlResult{Success: r.Success, Id: r.LeadId, Message: soapMessage(r.Errors)}
+		if r.Success {
+			results[i].Details = []string{
+				fmt.Sprint("accountId=", r.AccountId),
+				fmt.Sprint("contactId=", r.ContactId),
+				fmt.Sprint("opportunityId=", r.OpportunityId),
+			}
+		}
+	}
+	return results, nil
+}
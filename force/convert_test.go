@@ -0,0 +1,72 @@
+package force
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertLead(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	leads := server.Records("Lead")
+	accounts := server.Records("Account")
+	target := &SalesforceTarget{Instance: "test", SObject: "Lead", Operation: "CONVERTLEAD"}
+	reports := write(t, target, []string{"LeadId", "ConvertedStatus", "AccountId", "DoNotCreateOpportunity", "OpportunityName"}, []map[string]interface{}{
+		{"LeadId": leads[0]["Id"], "ConvertedStatus": "Qualified", "AccountId": accounts[0]["Id"], "DoNotCreateOpportunity": "TRUE"},
+		{"LeadId": leads[1]["Id"], "ConvertedStatus": "Qualified", "DoNotCreateOpportunity": false, "OpportunityName": "Umbrella deal"},
+		{"LeadId": leads[1]["Id"]},
+	})
+	if !reports[0].success || reports[0].id != leads[0]["Id"] || len(reports[0].details) != 3 {
+		t.Fatal("expected lead converted: ", reports[0].err)
+	}
+	if reports[0].details[0] != "accountId="+accounts[0]["Id"] || reports[0].details[2] != "opportunityId=" {
+		t.Fatal("unexpected details: ", reports[0].details)
+	}
+	if !reports[1].success || !strings.HasPrefix(reports[1].details[2], "opportunityId=006") {
+		t.Fatal("expected lead converted with opportunity: ", reports[1].err, reports[1].details)
+	}
+	if reports[2].success || !strings.Contains(reports[2].err, "ConvertedStatus") {
+		t.Fatal("expected error of missing status: ", reports[2].err)
+	}
+	if len(server.Records("Account")) != 4 || len(server.Records("Contact")) != 2 || server.Records("Opportunity")[0]["Name"] != "Umbrella deal" {
+		t.Fatal("unexpected records after conversion")
+	}
+	if lead := server.Records("Lead")[0]; lead["IsConverted"] != "true" || lead["ConvertedAccountId"] != accounts[0]["Id"] {
+		t.Fatal("expected lead converted into existing account: ", lead)
+	}
+}
+
+func TestConvertLeadFields(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Lead", Operation: "CONVERTLEAD"}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.NewWriter([]string{"LeadId", "Status"}); err == nil || !strings.Contains(err.Error(), "Status") {
+		t.Fatal("expected error of unknown field: ", err)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "CONVERTLEAD"}
+	if err := target.Init(noresolve); err == nil {
+		t.Fatal("expected error of object other than Lead")
+	}
+}
+
+func TestConvertLeadAdaptiveBatchSize(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Lead", Operation: "CONVERTLEAD", Adaptive: true}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"LeadId", "ConvertedStatus"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	adaptive := writer.(*ForceWriter).adaptive
+	adaptive.grow(MAX_CONVERT_BATCH_SIZE)
+	if size := writer.(*ForceWriter).currentBatchSize(); size != MAX_CONVERT_BATCH_SIZE {
+		t.Fatal("expected batch size of convert not grown above limit, got: ", size)
+	}
+}
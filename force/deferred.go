@@ -0,0 +1,194 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"strings"
+	"sync"
+)
+
+// deferredUpdate is a record written in the first pass with values of deferred fields to be updated in second pass
+type deferredUpdate struct {
+	id      string
+	created bool
+	values  map[string]interface{}
+	report  commons.Report
+	details []string
+}
+
+// deferredPass keeps ids of records created in the first pass and updates to be done in the second pass
+type deferredPass struct {
+	lock    sync.Mutex
+	fields  []string
+	key     string
+	newIds  map[string]string
+	updates []*deferredUpdate
+}
+
+// deferredReport collects results of the first pass, records with deferred values are reported after second pass.
+type deferredReport struct {
+	commons.Report
+	pass   *deferredPass
+	key    string
+	values map[string]interface{}
+}
+
+func newDeferredPass(fields []string, key string) *deferredPass {
+	return &deferredPass{fields: fields, key: key, newIds: make(map[string]string), updates: make([]*deferredUpdate, 0)}
+}
+
+func (r *deferredReport) Success(created bool, id string, details ...string) {
+	r.pass.lock.Lock()
+	if r.key != "" {
+		r.pass.newIds[deferredKey(r.key)] = id
+	}
+	if len(r.values) > 0 {
+		r.pass.updates = append(r.pass.updates, &deferredUpdate{id: id, created: created, values: r.values, report: r.Report, details: details})
+		r.pass.lock.Unlock()
+		return
+	}
+	r.pass.lock.Unlock()
+	r.Report.Success(created, id, details...)
+}
+
+// deferValues removes deferred fields from record and wraps report to collect results of the first pass.
+func (writer *ForceWriter) deferValues(record Record, report commons.Report) (Record, commons.Report, error) {
+	r := &deferredReport{Report: report, pass: writer.deferred, values: make(map[string]interface{})}
+	if writer.deferred.key != "" {
+		if v, ok := record.Get(writer.deferred.key); ok && v != nil {
+			r.key = String(v)
+		}
+	}
+	present := presentFields(record)
+	omitted := make(map[string]bool)
+	for _, f := range writer.deferred.fields {
+		name := topLevelFields([]string{f})[0]
+		omitted[strings.ToLower(name)] = true
+		if !present[strings.ToLower(name)] {
+			continue
+		}
+		if v, ok := record.Get(name); ok && v != nil && String(v) != "" {
+			r.values[name] = v
+		}
+	}
+	stripped, err := writer.copyRecord(record, writer.fieldsExcept(omitted))
+	if err != nil {
+		return nil, nil, err
+	}
+	return stripped, r, nil
+}
+
+// deferredKey returns key of a record loaded in the first pass. Salesforce ids are case sensitive and matched on
+// 15 characters id, so 15 and 18 characters ids of the same record match. Other keys, like external ids, match exactly.
+func deferredKey(key string) string {
+	if len(key) == 18 && key[15:] == idSuffix(key[:15]) {
+		return key[:15]
+	}
+	return key
+}
+
+// idSuffix returns case checksum of 15 characters salesforce id, which makes 18 characters id
+func idSuffix(id string) string {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ012345"
+	suffix := make([]byte, 3)
+	for i := 0; i < 3; i++ {
+		bits := 0
+		for j := 0; j < 5; j++ {
+			if c := id[i*5+j]; c >= 'A' && c <= 'Z' {
+				bits |= 1 << uint(j)
+			}
+		}
+		suffix[i] = chars[bits]
+	}
+	return string(suffix)
+}
+
+// resolve replaces keys of records loaded in the first pass with their new ids
+func (pass *deferredPass) resolve(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if id, ok := pass.newIds[deferredKey(s)]; ok {
+		return id
+	}
+	return value
+}
+
+// fail reports updates of the second pass, which were not done, as errors.
+func (pass *deferredPass) fail(updates []*deferredUpdate, message string) {
+	for _, u := range updates {
+		u.report.Error(fmt.Sprint("record ", u.id, " written, deferred fields update failed: ", message))
+	}
+}
+
+// secondPass updates deferred fields of the records created or updated in the first pass.
+func (writer *ForceWriter) secondPass() error {
+	pass := writer.deferred
+	if len(pass.updates) == 0 {
+		return nil
+	}
+	log.Println(commons.PROGRESS, "updating deferred fields of ", len(pass.updates), " records")
+	failed := 0
+	for start := 0; start < len(pass.updates); start += writer.batchSize {
+		end := start + writer.batchSize
+		if end > len(pass.updates) {
+			end = len(pass.updates)
+		}
+		batch := pass.updates[start:end]
+		if err := writer.instance.checkBudget(); err != nil {
+			writer.aborted = true
+			pass.fail(pass.updates[start:], err.Error())
+			return err
+		}
+		records := make([]Record, 0, len(batch))
+		for _, u := range batch {
+			record, err := writer.deferredRecord(u)
+			if err != nil {
+				pass.fail(pass.updates[start:], err.Error())
+				return err
+			}
+			records = append(records, record)
+		}
+		results, err := writer.instance.connection.Update(writer.sObjectDescribe.Name, records)
+		if err != nil {
+			pass.fail(pass.updates[start:], err.Error())
+			return errors.New(fmt.Sprint("error updating deferred fields: ", err))
+		}
+		if len(results) != len(records) {
+			pass.fail(pass.updates[start:], "incorrect result returned salesforce api")
+			return errors.New("incorrect result returned salesforce api")
+		}
+		for i, u := range batch {
+			if results[i].Success {
+				u.report.Success(u.created, u.id, append(u.details, "deferred fields updated")...)
+			} else {
+				failed++
+				u.report.Error(fmt.Sprint("record ", u.id, " written, deferred fields update failed: ", results[i].Message))
+			}
+		}
+	}
+	log.Println(commons.PROGRESS, "deferred fields updated, failed: ", failed)
+	return nil
+}
+
+// deferredRecord returns record updating deferred fields of a record written in the first pass.
+func (writer *ForceWriter) deferredRecord(u *deferredUpdate) (Record, error) {
+	record, err := NewDescribedRecord(writer.sObjectDescribe)
+	if err != nil {
+		return nil, err
+	}
+	record.Set("Id", u.id)
+	for field, value := range u.values {
+		if _, nested := value.(Record); !nested {
+			value = writer.deferred.resolve(value)
+		}
+		if _, err := record.Set(field, value); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
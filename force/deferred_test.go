@@ -0,0 +1,48 @@
+package force
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeferredKey(t *testing.T) {
+	pass := newDeferredPass([]string{"ParentId"}, "Id")
+	pass.newIds[deferredKey("001000000000aBc")] = "001000000000001"
+	pass.newIds[deferredKey("EXT-1")] = "001000000000002"
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"001000000000aBc", "001000000000001"},
+		// 18 characters id of the same record
+		{"001000000000aBcAAI", "001000000000001"},
+		// ids differing only in case are different records
+		{"001000000000AbC", "001000000000AbC"},
+		{"001000000000abcAAA", "001000000000abcAAA"},
+		{"EXT-1", "001000000000002"},
+		{"ext-1", "ext-1"},
+	}
+	for _, test := range tests {
+		if v := pass.resolve(test.value); v != test.expected {
+			t.Error("resolve ", test.value, ": expected ", test.expected, ", got ", v)
+		}
+	}
+}
+
+func TestDeferredInsertKey(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT", DeferredFields: []string{"Email"}}
+	if err := target.Init(noresolve); err == nil || !strings.Contains(err.Error(), "deferredKey") {
+		t.Fatal("expected error of insert without deferredKey: ", err)
+	}
+	target.DeferredKey = "LastName"
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	// upsert maps rows by external id
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UPSERT", ExternalId: "ExtId__c", DeferredFields: []string{"Name"}}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package force
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"os"
+	"strings"
+	"sync"
+)
+
+// directory caches ids of record types, users and queues of an instance, names are case insensitive.
+type directory struct {
+	lock        sync.Mutex
+	recordTypes map[string]string
+	users       map[string]string
+	queues      map[string]string
+}
+
+func (ins *Instance) getDirectory() *directory {
+	ins.lock.Lock()
+	defer ins.lock.Unlock()
+	if ins.directory == nil {
+		ins.directory = &directory{}
+	}
+	return ins.directory
+}
+
+func (ins *Instance) queryRecords(soql string) ([]Record, error) {
+	if err := ins.connect(); err != nil {
+		return nil, err
+	}
+	return readAll(ins.connection.Query(soql))
+}
+
+func fieldString(record Record, name string) string {
+	if v, ok := record.Get(name); ok && v != nil {
+		return String(v)
+	}
+	return ""
+}
+
+func (ins *Instance) recordTypeId(sObject string, developerName string) (string, error) {
+	dir := ins.getDirectory()
+	dir.lock.Lock()
+	defer dir.lock.Unlock()
+	if dir.recordTypes == nil {
+		records, err := ins.queryRecords("select Id, SobjectType, DeveloperName from RecordType")
+		if err != nil {
+			return "", errors.New(fmt.Sprint("error reading record types: ", err))
+		}
+		dir.recordTypes = make(map[string]string)
+		for _, r := range records {
+			dir.recordTypes[strings.ToLower(fieldString(r, "SobjectType")+"."+fieldString(r, "DeveloperName"))] = fieldString(r, "Id")
+		}
+	}
+	if id, ok := dir.recordTypes[strings.ToLower(sObject+"."+developerName)]; ok {
+		return id, nil
+	}
+	return "", errors.New(fmt.Sprint("record type not found: ", sObject, ".", developerName))
+}
+
+func (ins *Instance) queueId(developerName string) (string, error) {
+	dir := ins.getDirectory()
+	dir.lock.Lock()
+	defer dir.lock.Unlock()
+	if dir.queues == nil {
+		records, err := ins.queryRecords("select Id, DeveloperName from Group where Type = 'Queue'")
+		if err != nil {
+			return "", errors.New(fmt.Sprint("error reading queues: ", err))
+		}
+		dir.queues = make(map[string]string)
+		for _, r := range records {
+			dir.queues[strings.ToLower(fieldString(r, "DeveloperName"))] = fieldString(r, "Id")
+		}
+	}
+	if id, ok := dir.queues[strings.ToLower(developerName)]; ok {
+		return id, nil
+	}
+	return "", errors.New(fmt.Sprint("queue not found: ", developerName))
+}
+
+// userId resolves user by username, federation id or email, in that order. Email shared by several
+// users resolves to the active one, if there is only one active.
+func (ins *Instance) userId(name string) (string, error) {
+	dir := ins.getDirectory()
+	dir.lock.Lock()
+	defer dir.lock.Unlock()
+	if dir.users == nil {
+		records, err := ins.queryRecords("select Id, Username, Email, FederationIdentifier, IsActive from User")
+		if err != nil {
+			return "", errors.New(fmt.Sprint("error reading users: ", err))
+		}
+		dir.users = make(map[string]string)
+		emails := make(map[string][]Record)
+		for _, r := range records {
+			if email := strings.ToLower(fieldString(r, "Email")); email != "" {
+				emails[email] = append(emails[email], r)
+			}
+		}
+		for email, users := range emails {
+			active := make([]Record, 0, len(users))
+			for _, u := range users {
+				if strings.EqualFold(fieldString(u, "IsActive"), "true") {
+					active = append(active, u)
+				}
+			}
+			if len(users) == 1 {
+				dir.users["email:"+email] = fieldString(users[0], "Id")
+			} else if len(active) == 1 {
+				dir.users["email:"+email] = fieldString(active[0], "Id")
+			} else {
+				dir.users["email:"+email] = ""
+			}
+		}
+		for _, r := range records {
+			if fid := strings.ToLower(fieldString(r, "FederationIdentifier")); fid != "" {
+				dir.users["federation:"+fid] = fieldString(r, "Id")
+			}
+			dir.users["username:"+strings.ToLower(fieldString(r, "Username"))] = fieldString(r, "Id")
+		}
+	}
+	name = strings.ToLower(name)
+	for _, prefix := range []string{"username:", "federation:", "email:"} {
+		if id, ok := dir.users[prefix+name]; ok {
+			if id == "" {
+				return "", errors.New(fmt.Sprint("more than one user found: ", name))
+			}
+			return id, nil
+		}
+	}
+	return "", errors.New(fmt.Sprint("user not found: ", name))
+}
+
+// readUserMapping reads csv file with source user names in the first column and target user names in the second.
+// First line is a header.
+func readUserMapping(path string, mapping map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.New(fmt.Sprint("cannot open file:", path))
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return errors.New(fmt.Sprint("error reading user mapping: ", path, " : ", err))
+	}
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(row) < 2 {
+			return errors.New(fmt.Sprint("error reading user mapping: ", path, " : two columns expected at line ", i+1))
+		}
+		mapping[strings.ToLower(strings.TrimSpace(row[0]))] = strings.TrimSpace(row[1])
+	}
+	return nil
+}
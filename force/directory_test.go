@@ -0,0 +1,91 @@
+package force
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func directoryFunctions(t *testing.T, mapping map[string]string) func(string, ...interface{}) (interface{}, error) {
+	target := &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "INSERT", UserMapping: mapping}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	functions := target.NewFunctionsSupplier()
+	return func(name string, args ...interface{}) (interface{}, error) {
+		return functions(name, args)
+	}
+}
+
+func TestRecordTypeAndQueue(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	call := directoryFunctions(t, nil)
+	recordTypes := server.Records("RecordType")
+	if id, err := call("RECORDTYPE", "Account", "Partner"); err != nil || id != recordTypes[0]["Id"] {
+		t.Fatal("unexpected record type: ", id, err)
+	}
+	// names are case insensitive and read only once
+	queries := server.Calls("query")
+	if id, err := call("RECORDTYPE", "contact", "PARTNER"); err != nil || id != recordTypes[1]["Id"] {
+		t.Fatal("unexpected record type: ", id, err)
+	}
+	if _, err := call("RECORDTYPE", "Account", "Reseller"); err == nil || !strings.Contains(err.Error(), "record type not found") {
+		t.Fatal("expected error of missing record type: ", err)
+	}
+	if server.Calls("query") != queries {
+		t.Fatal("expected record types cached")
+	}
+	if id, err := call("QUEUE", "support"); err != nil || id != server.Records("Group")[0]["Id"] {
+		t.Fatal("unexpected queue: ", id, err)
+	}
+	// groups other than queues are not found
+	if _, err := call("QUEUE", "Sales"); err == nil || !strings.Contains(err.Error(), "queue not found") {
+		t.Fatal("expected error of missing queue: ", err)
+	}
+	if id, err := call("QUEUE", nil); err != nil || id != nil {
+		t.Fatal("expected null for null queue: ", id, err)
+	}
+}
+
+func TestUser(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	call := directoryFunctions(t, map[string]string{"Ann.Old@Source.com": "E100"})
+	ann := server.Records("User")[0]["Id"]
+	for _, name := range []string{"ANN@example.com.prod", "e100", "ann@example.com", "ann.old@source.com"} {
+		if id, err := call("USER", name); err != nil || id != ann {
+			t.Error("unexpected user of ", name, ": ", id, err)
+		}
+	}
+	if server.Calls("query") != 1 {
+		t.Fatal("expected users cached, got queries: ", server.Calls("query"))
+	}
+	if _, err := call("USER", "team@example.com"); err == nil || !strings.Contains(err.Error(), "more than one user") {
+		t.Fatal("expected error of ambiguous email: ", err)
+	}
+	if _, err := call("USER", "nobody@example.com"); err == nil || !strings.Contains(err.Error(), "user not found") {
+		t.Fatal("expected error of missing user: ", err)
+	}
+}
+
+func TestReadUserMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := ioutil.WriteFile(path, []byte("source,target\n Bob@Source.com ,bob@example.com.prod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapping := make(map[string]string)
+	if err := readUserMapping(path, mapping); err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping) != 1 || mapping["bob@source.com"] != "bob@example.com.prod" {
+		t.Fatal("unexpected mapping: ", mapping)
+	}
+	if err := ioutil.WriteFile(path, []byte("source,target\nbob@source.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readUserMapping(path, mapping); err == nil {
+		t.Fatal("expected error of missing column")
+	}
+}
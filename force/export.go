@@ -0,0 +1,101 @@
+package force
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/eval"
+	"github.com/goforce/reloader/commons"
+	"github.com/goforce/reloader/force/soqlparser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// binaryFields maps sObjects with file content to the name of the field holding base64 content
+var binaryFields = map[string]string{
+	"contentversion": "VersionData",
+	"attachment":     "Body",
+	"document":       "Body",
+}
+
+func (s *SalesforceSource) initExport() (err error) {
+	object := s.SObject
+	if object == "" {
+		object = soqlparser.SoqlObject(s.Query)
+	}
+	field, ok := binaryFields[strings.ToLower(object)]
+	if !ok {
+		return errors.New(fmt.Sprint("exportFiles can be used only with ContentVersion, Attachment or Document, not: ", object))
+	}
+	// without content in the query there would be nothing to export
+	if s.Query != "" && !commons.ContainsFold(soqlparser.SoqlFields(s.Query), field) {
+		return errors.New(fmt.Sprint("exportFiles needs ", field, " field in the query of ", object))
+	}
+	s.binaryField = field
+	s.exportFiles, err = eval.ParseString(s.ExportFiles)
+	if err != nil {
+		return errors.New(fmt.Sprint("error in exportFiles: ", s.ExportFiles, "\n", err))
+	}
+	return nil
+}
+
+// exportFile writes binary content of the record to the file with path evaluated from exportFiles formula.
+// Content in the record is replaced with the path of the file.
+func (reader *ForceReader) exportFile(record Record) error {
+	value, ok := record.Get(reader.binaryField)
+	if !ok || value == nil {
+		return nil
+	}
+	var content []byte
+	switch value.(type) {
+	case []byte:
+		content = value.([]byte)
+	default:
+		var err error
+		content, err = base64.StdEncoding.DecodeString(String(value))
+		if err != nil {
+			return errors.New(fmt.Sprint("error decoding ", reader.binaryField, ": ", err))
+		}
+	}
+	context := eval.NewContext()
+	context.AddValues(func(name string) (interface{}, bool) {
+		return record.Get(name)
+	})
+	p, err := reader.exportFiles.Eval(context)
+	if err != nil {
+		return errors.New(fmt.Sprint("error in exportFiles: ", err))
+	}
+	path, err := exportPath(String(p))
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.New(fmt.Sprint("cannot create directory: ", dir, " : ", err))
+		}
+	}
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return errors.New(fmt.Sprint("cannot write file: ", path, " : ", err))
+	}
+	_, err = record.Set(reader.binaryField, path)
+	return err
+}
+
+// exportPath cleans path evaluated from exportFiles formula. Paths are relative to the working directory, absolute
+// ones or going up with .. are rejected, so values of records can not write files outside of it.
+func exportPath(path string) (string, error) {
+	if path == "" {
+		return "", errors.New(fmt.Sprint("exportFiles evaluated to empty path"))
+	}
+	cleaned := filepath.Clean(path)
+	if filepath.IsAbs(cleaned) || strings.HasPrefix(cleaned, `\`) || strings.HasPrefix(cleaned, "/") {
+		return "", errors.New(fmt.Sprint("exportFiles evaluated to absolute path: ", path))
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", errors.New(fmt.Sprint("exportFiles evaluated to path outside of working directory: ", path))
+	}
+	return cleaned, nil
+}
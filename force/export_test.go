@@ -0,0 +1,35 @@
+package force
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"report.pdf":            "report.pdf",
+		"docs/Contracts/a.pdf":  "docs/Contracts/a.pdf",
+		"docs/./x/../a.pdf":     "docs/a.pdf",
+		"docs/../../etc/passwd": "",
+		"../a.pdf":              "",
+		"..":                    "",
+		"/etc/passwd":           "",
+		"":                      "",
+	} {
+		cleaned, err := exportPath(path)
+		if expected == "" && err == nil || expected != "" && cleaned != expected {
+			t.Error("path ", path, " expected ", expected, ", got ", cleaned, " ", err)
+		}
+	}
+}
+
+func TestExportNeedsContent(t *testing.T) {
+	source := &SalesforceSource{Query: "select Id, Title from ContentVersion", ExportFiles: "'docs/' + Title"}
+	if err := source.initExport(); err == nil || !strings.Contains(err.Error(), "VersionData") {
+		t.Fatal("expected error of query without content: ", err)
+	}
+	source.Query = "select Id, Title, versiondata from ContentVersion"
+	if err := source.initExport(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+package force
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/reloader/commons"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	MAX_FILE_SIZE          int64 = 25 * 1024 * 1024
+	MAX_BINARY_BATCH_SIZE  int   = 10
+	MAX_BINARY_BATCH_BYTES int   = 30 * 1024 * 1024
+)
+
+// detailedReport adds details to success reported for a record, used to log uploaded files.
+type detailedReport struct {
+	commons.Report
+	details []string
+}
+
+func (r *detailedReport) Success(created bool, id string, details ...string) {
+	r.Report.Success(created, id, append(r.details, details...)...)
+}
+
+// fileFields returns fields flagged as fileContent.
+func (writer *ForceWriter) fileFields() []string {
+	fields := make([]string, 0)
+	for field, ff := range writer.flags {
+		if ff[commons.FLAG_FILE_CONTENT] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// loadFiles replaces paths in fileContent fields with base64 encoded content of the files.
+// It returns number of bytes added to the record and details to be logged on success.
+func (writer *ForceWriter) loadFiles(record Record) (int, []string, error) {
+	size := 0
+	details := make([]string, 0)
+	for _, field := range writer.fileFields() {
+		value, _ := record.Get(field)
+		path := strings.TrimSpace(String(value))
+		if value == nil || path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, nil, errors.New(fmt.Sprint("cannot read file: ", path, " : ", err))
+		}
+		if info.Size() > writer.maxFileSize {
+			return 0, nil, errors.New(fmt.Sprint("file too large: ", path, " ", info.Size(), " bytes, max ", writer.maxFileSize))
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0, nil, errors.New(fmt.Sprint("cannot read file: ", path, " : ", err))
+		}
+		encoded := base64.StdEncoding.EncodeToString(content)
+		if _, err := record.Set(field, encoded); err != nil {
+			return 0, nil, err
+		}
+		size += len(encoded)
+		details = append(details, fmt.Sprint("file=", filepath.Base(path)), fmt.Sprint("size=", len(content)))
+	}
+	return size, details, nil
+}
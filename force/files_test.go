@@ -0,0 +1,116 @@
+package force
+
+import (
+	"encoding/base64"
+	"github.com/goforce/reloader/commons"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tempFile(t *testing.T, dir string, name string, size int) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(strings.Repeat("x", size)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer := &ForceWriter{maxFileSize: 10}
+	writer.SetFlags(commons.Flags{"Body": {commons.FLAG_FILE_CONTENT: true}})
+	record := newMapRecord()
+	record.Set("Name", "hello.txt")
+	record.Set("Body", tempFile(t, dir, "hello.txt", 5))
+	size, details, err := writer.loadFiles(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte("xxxxx"))
+	if body, _ := record.Get("Body"); body != encoded || size != len(encoded) {
+		t.Fatal("unexpected content: ", body, " size ", size)
+	}
+	if strings.Join(details, ";") != "file=hello.txt;size=5" {
+		t.Fatal("unexpected details: ", details)
+	}
+	record.Set("Body", " ")
+	if size, _, err := writer.loadFiles(record); err != nil || size != 0 {
+		t.Fatal("expected blank path skipped: ", size, err)
+	}
+	record.Set("Body", tempFile(t, dir, "large.txt", 11))
+	if _, _, err := writer.loadFiles(record); err == nil || !strings.Contains(err.Error(), "file too large") {
+		t.Fatal("expected error of large file: ", err)
+	}
+	record.Set("Body", filepath.Join(dir, "missing.txt"))
+	if _, _, err := writer.loadFiles(record); err == nil || !strings.Contains(err.Error(), "cannot read file") {
+		t.Fatal("expected error of missing file: ", err)
+	}
+}
+
+func TestDetailedReport(t *testing.T) {
+	r := &testReport{}
+	report := &detailedReport{Report: r, details: []string{"file=a.txt", "size=1"}}
+	report.Success(true, "015000000000001", "uploaded")
+	if !r.success || !r.created || strings.Join(r.details, ";") != "file=a.txt;size=1;uploaded" {
+		t.Fatal("unexpected report: ", r.success, r.created, r.details)
+	}
+}
+
+func TestBinaryBatchSplit(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// two large files encoded in base64 do not fit into one batch
+	large := 12 * 1024 * 1024
+	rows := []map[string]interface{}{
+		{"Name": "a", "Body": tempFile(t, dir, "a.txt", 10)},
+		{"Name": "b", "Body": tempFile(t, dir, "b.txt", 10)},
+		{"Name": "c", "Body": tempFile(t, dir, "c.txt", large)},
+		{"Name": "d", "Body": tempFile(t, dir, "d.txt", large)},
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Document", Operation: "INSERT"}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"Name", "Body"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.(commons.UsesFlags).SetFlags(commons.Flags{"Body": {commons.FLAG_FILE_CONTENT: true}})
+	reports := make([]*testReport, 0)
+	for _, row := range rows {
+		record := writer.NewRecord()
+		record.Set("Name", row["Name"])
+		record.Set("Body", row["Body"])
+		report := &testReport{}
+		reports = append(reports, report)
+		if err := writer.Write(record, report, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if !r.success {
+			t.Fatal("expected document inserted: ", r.err)
+		}
+	}
+	if server.Calls("create") != 2 || len(server.Records("Document")) != 4 {
+		t.Fatal("expected documents sent in two batches, got: ", server.Calls("create"))
+	}
+	if strings.Join(reports[3].details, ";") != "file=d.txt;size=12582912" {
+		t.Fatal("unexpected details: ", reports[3].details)
+	}
+}
@@ -0,0 +1,117 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"strings"
+)
+
+// SetFlags implements commons.UsesFlags. Flags are kept only for the fields having at least one flag set.
+func (writer *ForceWriter) SetFlags(flags commons.Flags) {
+	writer.flags = make(commons.Flags)
+	for field, ff := range flags {
+		if len(ff) > 0 {
+			writer.flags[field] = ff
+		}
+	}
+	writer.binary = len(writer.fileFields()) > 0
+}
+
+// insertOnlyFields returns top level names of the fields flagged as insertOnly.
+func (writer *ForceWriter) insertOnlyFields() []string {
+	fields := make([]string, 0)
+	for field, ff := range writer.flags {
+		if ff[commons.FLAG_INSERT_ONLY] {
+			fields = append(fields, topLevelFields([]string{field})[0])
+		}
+	}
+	return fields
+}
+
+// applyFlags normalizes values of flagged fields and checks required ones. Returned record has fields which should not
+// be sent to salesforce removed.
+func (writer *ForceWriter) applyFlags(record Record) (Record, error) {
+	if len(writer.flags) == 0 {
+		return record, nil
+	}
+	omitted := make(map[string]bool)
+	for field, ff := range writer.flags {
+		value, _ := record.Get(field)
+		blank := value == nil
+		if s, ok := value.(string); ok {
+			if ff[commons.FLAG_TRIM] {
+				s = strings.TrimSpace(s)
+				if _, err := record.Set(field, s); err != nil {
+					return nil, err
+				}
+			}
+			blank = strings.TrimSpace(s) == ""
+		}
+		if blank && ff[commons.FLAG_REQUIRED] {
+			return nil, errors.New(fmt.Sprint("required field is blank: ", field))
+		}
+		// nil values are sent as fieldsToNull and clear the field, fieldsToNull clears it on update whatever the value is
+		toNull := ff[commons.FLAG_FIELDS_TO_NULL] && (writer.operation == "UPDATE" || writer.operation == "UPSERT")
+		if toNull || blank && ff[commons.FLAG_NULL_IF_BLANK] {
+			if _, err := record.Set(field, nil); err != nil {
+				return nil, err
+			}
+		}
+		if ff[commons.FLAG_INSERT_ONLY] && writer.operation == "UPDATE" {
+			omitted[strings.ToLower(topLevelFields([]string{field})[0])] = true
+		}
+	}
+	if len(omitted) == 0 {
+		return record, nil
+	}
+	return writer.copyRecord(record, writer.fieldsExcept(omitted))
+}
+
+// fieldsExcept returns top level fields of the writer except the listed ones, names in omitted should be lower case.
+func (writer *ForceWriter) fieldsExcept(omitted map[string]bool) []string {
+	fields := make([]string, 0, len(writer.topFields))
+	for _, f := range writer.topFields {
+		if !omitted[strings.ToLower(f)] {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// removeInsertOnly drops insertOnly fields from records which are going to be updated by upsert.
+func (writer *ForceWriter) removeInsertOnly(records []Record, reports []commons.Report) ([]Record, []commons.Report) {
+	insertOnly := writer.insertOnlyFields()
+	if writer.operation != "UPSERT" || len(insertOnly) == 0 {
+		return records, reports
+	}
+	current, err := writer.fetchCurrent(records, nil)
+	if err != nil {
+		log.Println(commons.ERRORS, err)
+		panic("error calling salesforce api")
+	}
+	omitted := make(map[string]bool)
+	for _, f := range insertOnly {
+		omitted[strings.ToLower(f)] = true
+	}
+	fields := writer.fieldsExcept(omitted)
+	key := writer.matchKey()
+	keptRecords := make([]Record, 0, len(records))
+	keptReports := make([]commons.Report, 0, len(reports))
+	for i, record := range records {
+		k, _ := record.Get(key)
+		if _, ok := current[keyValue(key, k)]; ok {
+			updated, err := writer.copyRecord(record, fields)
+			if err != nil {
+				reports[i].Error(err.Error())
+				continue
+			}
+			record = updated
+		}
+		keptRecords = append(keptRecords, record)
+		keptReports = append(keptReports, reports[i])
+	}
+	return keptRecords, keptReports
+}
@@ -0,0 +1,63 @@
+package force
+
+import (
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/reloader/commons"
+	"strings"
+	"testing"
+)
+
+func TestApplyFlags(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "UPDATE"}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	w, err := target.NewWriter([]string{"Id", "LastName", "Email", "AccountId"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	writer := w.(*ForceWriter)
+	writer.SetFlags(commons.Flags{
+		"LastName":  {commons.FLAG_TRIM: true, commons.FLAG_REQUIRED: true},
+		"Email":     {commons.FLAG_NULL_IF_BLANK: true},
+		"AccountId": {commons.FLAG_FIELDS_TO_NULL: true},
+	})
+	record := writer.NewRecord()
+	record.Set("Id", "003000000000001")
+	record.Set("LastName", " Smith ")
+	record.Set("Email", "  ")
+	record.Set("AccountId", "001000000000001")
+	flagged, err := writer.applyFlags(record.(Record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mustGet(t, flagged, "LastName") != "Smith" {
+		t.Fatal("expected trimmed value: ", flagged)
+	}
+	// blank value is sent as null, so update clears the field
+	if v, ok := flagged.Get("Email"); !ok || v != nil {
+		t.Fatal("expected null value of blank field: ", v, ok)
+	}
+	// fieldsToNull clears the field on update even if it has a value
+	if v, ok := flagged.Get("AccountId"); !ok || v != nil {
+		t.Fatal("expected null value of fieldsToNull field: ", v, ok)
+	}
+	record.Set("Email", "smith@example.com")
+	if flagged, err = writer.applyFlags(record.(Record)); err != nil || mustGet(t, flagged, "Email") != "smith@example.com" {
+		t.Fatal("expected value of nullIfBlank field kept: ", flagged, err)
+	}
+	// values are kept on insert
+	writer.operation = "INSERT"
+	record.Set("AccountId", "001000000000001")
+	if flagged, err = writer.applyFlags(record.(Record)); err != nil || mustGet(t, flagged, "AccountId") != "001000000000001" {
+		t.Fatal("expected value of fieldsToNull field kept on insert: ", flagged, err)
+	}
+	writer.operation = "UPDATE"
+	record.Set("LastName", "  ")
+	if _, err := writer.applyFlags(record.(Record)); err == nil || !strings.Contains(err.Error(), "LastName") {
+		t.Fatal("expected error of required field: ", err)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/goforce/api/soap"
+	"github.com/goforce/eval"
 	"github.com/goforce/reloader/commons"
+	"strings"
+	"sync"
 )
 
 type Salesforce struct {
@@ -13,33 +16,59 @@ type Salesforce struct {
 }
 
 type Instance struct {
-	Url        string                 `json:"url"`
-	Username   string                 `json:"username"`
-	Password   string                 `json:"password"`
-	Token      string                 `json:"token"`
-	Values     map[string]interface{} `json:"values"`
+	Url      string                 `json:"url"`
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Token    string                 `json:"token"`
+	Values   map[string]interface{} `json:"values"`
+	// api used by readers and writers: soap (default) or rest
+	Api        string     `json:"api"`
+	Budget     *ApiBudget `json:"budget"`
 	connector  func(instance *Instance) (*soap.Connection, error)
-	connection *soap.Connection
+	connection Connection
+	// connection returned by connector, its session is shared by rest calls
+	soap        *soap.Connection
+	session     *session
+	usage       apiUsage
+	directory   *directory
+	lock        sync.Mutex
+	connectLock sync.Mutex
 }
 
 type SalesforceSource struct {
 	//	commons.EndPoint
-	Instance string `json:"instance"`
-	Query    string `json:"query"`
-	SObject  string `json:"sObject"`
-	instance *Instance
+	Instance    string `json:"instance"`
+	Query       string `json:"query"`
+	SObject     string `json:"sObject"`
+	ExportFiles string `json:"exportFiles"`
+	// read deleted and archived records too
+	QueryAll    bool `json:"queryAll"`
+	instance    *Instance
+	exportFiles eval.Expr
+	binaryField string
 }
 
 type SalesforceTarget struct {
 	//	commons.EndPoint
-	Instance   string `json:"instance"`
-	SObject    string `json:"sobject"`
-	Operation  string `json:"operation"`
-	ExternalId string `json:"externalId"`
-	BatchSize  int    `json:"batchSize"`
-	Workers    int    `json:"workers"`
-	instance   *Instance
-	lookups    map[string]commons.Scan
+	Instance    string `json:"instance"`
+	SObject     string `json:"sobject"`
+	Operation   string `json:"operation"`
+	ExternalId  string `json:"externalId"`
+	BatchSize   int    `json:"batchSize"`
+	Workers     int    `json:"workers"`
+	OnlyChanged bool   `json:"onlyChanged"`
+	Adaptive    bool   `json:"adaptive"`
+	MaxWorkers  int    `json:"maxWorkers"`
+	MaxFileSize int64  `json:"maxFileSize"`
+	// fields loaded in the second pass, after all records are written
+	DeferredFields []string `json:"deferredFields"`
+	DeferredKey    string   `json:"deferredKey"`
+	// source user names mapped to user names of the target instance, used by USER function
+	UserMapping     map[string]string `json:"userMapping"`
+	UserMappingFile string            `json:"userMappingFile"`
+	instance        *Instance
+	lookups         map[string]commons.Scan
+	lookupsLock     sync.Mutex
 }
 
 // salesforce globals
@@ -63,6 +92,13 @@ func (config *Salesforce) Init(resolver func(string) string) error {
 		if instance.Values == nil {
 			instance.Values = make(map[string]interface{})
 		}
+		instance.Api = strings.ToLower(resolver(instance.Api))
+		if instance.Api != "" && instance.Api != "soap" && instance.Api != "rest" {
+			return errors.New(fmt.Sprint("unknown api: ", instance.Api, ", expected soap or rest"))
+		}
+		if err := instance.Budget.init(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -83,6 +119,11 @@ func (s *SalesforceSource) Init(resolver func(string) string) (err error) {
 	if s.Query != "" && s.SObject != "" {
 		return errors.New(fmt.Sprint("you should not set both query and sObject, only one allowed"))
 	}
+	if s.ExportFiles != "" {
+		if err = s.initExport(); err != nil {
+			return err
+		}
+	}
 	// resolver instance
 	s.instance, err = resolveInstance(s.Instance)
 	return
@@ -104,6 +145,40 @@ func (s *SalesforceTarget) Init(resolver func(string) string) (err error) {
 	if s.Operation == "" {
 		return errors.New(fmt.Sprint("operation should be specified"))
 	}
+	if strings.ToUpper(s.Operation) == "MERGE" && !commons.ContainsFold(mergeableObjects, s.SObject) {
+		return errors.New(fmt.Sprint("MERGE operation is supported only for ", strings.Join(mergeableObjects, ", ")))
+	}
+	if strings.ToUpper(s.Operation) == "PUBLISH" && !strings.HasSuffix(strings.ToLower(s.SObject), "__e") {
+		return errors.New(fmt.Sprint("PUBLISH operation is supported only for platform events, got: ", s.SObject))
+	}
+	if strings.ToUpper(s.Operation) == "CONVERTLEAD" && !strings.EqualFold(s.SObject, "Lead") {
+		return errors.New(fmt.Sprint("CONVERTLEAD operation is supported only for Lead"))
+	}
+	if len(s.DeferredFields) > 0 {
+		if op := strings.ToUpper(s.Operation); op != "INSERT" && op != "UPSERT" {
+			return errors.New(fmt.Sprint("deferredFields can be used only with INSERT or UPSERT operation"))
+		}
+		// source rows are mapped to new ids by the key, insert has no external id to be used instead
+		if strings.ToUpper(s.Operation) == "INSERT" && s.DeferredKey == "" {
+			return errors.New(fmt.Sprint("deferredKey should be specified for deferredFields with INSERT operation"))
+		}
+	}
+	if s.OnlyChanged {
+		if op := strings.ToUpper(s.Operation); op != "UPDATE" && op != "UPSERT" {
+			return errors.New(fmt.Sprint("onlyChanged can be used only with UPDATE or UPSERT operation"))
+		}
+	}
+	// user mapping keys are case insensitive
+	users := make(map[string]string)
+	for k, v := range s.UserMapping {
+		users[strings.ToLower(k)] = v
+	}
+	s.UserMapping = users
+	if s.UserMappingFile = resolver(s.UserMappingFile); s.UserMappingFile != "" {
+		if err = readUserMapping(s.UserMappingFile, s.UserMapping); err != nil {
+			return err
+		}
+	}
 	// resolver instance
 	s.instance, err = resolveInstance(s.Instance)
 	// init lookups
@@ -138,10 +213,49 @@ func (ins *Instance) SetConnector(connector func(instance *Instance) (*soap.Conn
 	ins.connector = connector
 }
 
-func (ins *Instance) connect() (err error) {
-	if ins.connection == nil {
-		ins.connection, err = ins.connector(ins)
+// restSession returns session for rest and raw soap calls, it shares the session of the connection of the instance.
+func (ins *Instance) restSession() (*session, error) {
+	if err := ins.connect(); err != nil {
+		return nil, err
+	}
+	return ins.sessionOf(ins.soap)
+}
+
+// sessionOf returns session of the connection, it is created on first call.
+func (ins *Instance) sessionOf(connection *soap.Connection) (*session, error) {
+	ins.lock.Lock()
+	defer ins.lock.Unlock()
+	if ins.session == nil {
+		s, err := newSession(ins, connection)
+		if err != nil {
+			return nil, err
+		}
+		ins.session = s
+	}
+	return ins.session, nil
+}
+
+// connect logs in using connector of the instance. Readers, writers, lookups and transformers could connect
+// concurrently, the connection is created once.
+func (ins *Instance) connect() error {
+	ins.connectLock.Lock()
+	defer ins.connectLock.Unlock()
+	if ins.connection != nil {
+		return nil
+	}
+	connection, err := ins.connector(ins)
+	if err != nil {
 		return err
 	}
+	ins.soap = connection
+	if ins.Api == "rest" {
+		s, err := ins.sessionOf(connection)
+		if err != nil {
+			return err
+		}
+		ins.connection = newRestConnection(&soapConnection{connection, &ins.usage, ins.restSession}, s)
+	} else {
+		ins.connection = &soapConnection{connection, &ins.usage, ins.restSession}
+	}
 	return nil
 }
@@ -0,0 +1,198 @@
+package force
+
+import (
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/api/soap"
+	"github.com/goforce/reloader/commons"
+	"github.com/goforce/reloader/force/forcetest"
+	"sync"
+	"testing"
+)
+
+func noresolve(s string) string {
+	return s
+}
+
+// testObjects returns accounts with contacts, leads, opportunities, documents, record types, users, queues and an
+// event used by tests of the package
+func testObjects() []*forcetest.Object {
+	return []*forcetest.Object{
+		&forcetest.Object{
+			Name:   "Account",
+			Prefix: "001",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "Name", Type: "string", Required: true},
+				&forcetest.Field{Name: "Type", Type: "picklist", Picklist: []string{"Customer", "Partner"}, Restricted: true},
+				&forcetest.Field{Name: "ExtId__c", Type: "string", ExternalId: true},
+				&forcetest.Field{Name: "AnnualRevenue", Type: "currency"},
+				&forcetest.Field{Name: "Active__c", Type: "boolean"},
+				&forcetest.Field{Name: "Since__c", Type: "date"},
+			},
+			Records: []map[string]string{
+				{"Name": "Acme", "Type": "Customer", "ExtId__c": "A1"},
+				{"Name": "Globex", "Type": "Partner", "ExtId__c": "A2"},
+				{"Name": "Initech", "ExtId__c": "A3"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "Contact",
+			Prefix: "003",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "LastName", Type: "string", Required: true},
+				&forcetest.Field{Name: "Email", Type: "email"},
+				&forcetest.Field{Name: "AccountId", Type: "reference", ReferenceTo: "Account", RelationshipName: "Account"},
+				&forcetest.Field{Name: "Greeting__c", Type: "string", Formula: true},
+			},
+		},
+		&forcetest.Object{
+			Name:   "Lead",
+			Prefix: "00Q",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "LastName", Type: "string", Required: true},
+				&forcetest.Field{Name: "Company", Type: "string"},
+				&forcetest.Field{Name: "Status", Type: "picklist", Picklist: []string{"Open", "Qualified"}},
+				&forcetest.Field{Name: "IsConverted", Type: "boolean", ReadOnly: true},
+				&forcetest.Field{Name: "ConvertedAccountId", Type: "reference", ReferenceTo: "Account", ReadOnly: true},
+				&forcetest.Field{Name: "ConvertedContactId", Type: "reference", ReferenceTo: "Contact", ReadOnly: true},
+			},
+			Records: []map[string]string{
+				{"LastName": "Brown", "Company": "Hooli", "Status": "Open"},
+				{"LastName": "Green", "Company": "Umbrella", "Status": "Open"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "Opportunity",
+			Prefix: "006",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "Name", Type: "string", Required: true},
+				&forcetest.Field{Name: "AccountId", Type: "reference", ReferenceTo: "Account", RelationshipName: "Account"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "Document",
+			Prefix: "015",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "Name", Type: "string", Required: true},
+				&forcetest.Field{Name: "Body", Type: "base64"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "RecordType",
+			Prefix: "012",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "SobjectType", Type: "string"},
+				&forcetest.Field{Name: "DeveloperName", Type: "string"},
+			},
+			Records: []map[string]string{
+				{"SobjectType": "Account", "DeveloperName": "Partner"},
+				{"SobjectType": "Contact", "DeveloperName": "Partner"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "User",
+			Prefix: "005",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "Username", Type: "string"},
+				&forcetest.Field{Name: "Email", Type: "email"},
+				&forcetest.Field{Name: "FederationIdentifier", Type: "string"},
+				&forcetest.Field{Name: "IsActive", Type: "boolean"},
+			},
+			Records: []map[string]string{
+				{"Username": "ann@example.com.prod", "Email": "ann@example.com", "FederationIdentifier": "E100", "IsActive": "true"},
+				{"Username": "ann.old@example.com.prod", "Email": "ann@example.com", "IsActive": "false"},
+				{"Username": "bob@example.com.prod", "Email": "team@example.com", "IsActive": "true"},
+				{"Username": "carl@example.com.prod", "Email": "team@example.com", "IsActive": "true"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "Group",
+			Prefix: "00G",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "DeveloperName", Type: "string"},
+				&forcetest.Field{Name: "Type", Type: "string"},
+			},
+			Records: []map[string]string{
+				{"DeveloperName": "Support", "Type": "Queue"},
+				{"DeveloperName": "Sales", "Type": "Regular"},
+			},
+		},
+		&forcetest.Object{
+			Name:   "Order_Placed__e",
+			Prefix: "e00",
+			Fields: []*forcetest.Field{
+				&forcetest.Field{Name: "OrderNumber__c", Type: "string", Required: true},
+				&forcetest.Field{Name: "Amount__c", Type: "double"},
+			},
+		},
+	}
+}
+
+// newTestServer starts fake salesforce and configures it as instance named test
+func newTestServer(t *testing.T) *forcetest.Server {
+	return newApiTestServer(t, "")
+}
+
+func newApiTestServer(t *testing.T, api string) *forcetest.Server {
+	server := forcetest.NewServer(testObjects()...)
+	instance := &Instance{Url: server.URL, Username: forcetest.USERNAME, Password: forcetest.PASSWORD, Api: api}
+	instance.SetConnector(func(ins *Instance) (*soap.Connection, error) {
+		return soap.Login(ins.Url, ins.Username, ins.Password+ins.Token)
+	})
+	config := &Salesforce{Instances: map[string]*Instance{"test": instance}}
+	if err := config.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+type testReport struct {
+	lock    sync.Mutex
+	skipped string
+	success bool
+	created bool
+	id      string
+	details []string
+	err     string
+	output  commons.Record
+}
+
+func (r *testReport) Skip(reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.skipped = reason
+}
+
+func (r *testReport) Success(created bool, id string, details ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.success, r.created, r.id, r.details = true, created, id, details
+}
+
+func (r *testReport) Error(message string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.err = message
+}
+
+func (r *testReport) Output(record commons.Record) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.output = record
+}
+
+func findRecord(records []map[string]string, field string, value string) map[string]string {
+	for _, r := range records {
+		if r[field] == value {
+			return r
+		}
+	}
+	return nil
+}
+
+func mustGet(t *testing.T, record Record, field string) string {
+	v, ok := record.Get(field)
+	if !ok {
+		t.Fatal("no field in record: ", field)
+	}
+	return String(v)
+}
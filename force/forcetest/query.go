@@ -0,0 +1,149 @@
+package forcetest
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parsedQuery is a subset of soql: select fields from object [where conditions joined by and] [order by ...] [limit n]
+type parsedQuery struct {
+	fields     []string
+	sObject    string
+	conditions []*condition
+	limit      int
+}
+
+// condition is field = value, field != value, field in (values) or field not in (values), nil value is null
+type condition struct {
+	field  string
+	negate bool
+	values []*string
+}
+
+var (
+	queryPattern     = regexp.MustCompile(`(?is)^\s*select\s+(.+?)\s+from\s+(\w+)(?:\s+where\s+(.+?))?(?:\s+order\s+by\s+.+?)?(?:\s+limit\s+(\d+))?\s*$`)
+	conditionPattern = regexp.MustCompile(`(?is)^\s*([\w.]+)\s*(=|!=|not\s+in|in)\s*(.+?)\s*$`)
+	andPattern       = regexp.MustCompile(`(?i)^\s+and\s+`)
+)
+
+func parseQuery(soql string) (*parsedQuery, error) {
+	m := queryPattern.FindStringSubmatch(soql)
+	if m == nil {
+		return nil, errors.New("unexpected query: " + soql)
+	}
+	q := &parsedQuery{sObject: m[2], limit: -1}
+	for _, f := range strings.Split(m[1], ",") {
+		q.fields = append(q.fields, strings.TrimSpace(f))
+	}
+	if m[3] != "" {
+		parts, err := splitAnd(m[3])
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			c, err := parseCondition(part)
+			if err != nil {
+				return nil, err
+			}
+			q.conditions = append(q.conditions, c)
+		}
+	}
+	if m[4] != "" {
+		q.limit, _ = strconv.Atoi(m[4])
+	}
+	return q, nil
+}
+
+// splitAnd splits where clause by and operators outside of quotes and parentheses
+func splitAnd(where string) ([]string, error) {
+	parts := make([]string, 0)
+	start, depth, quoted := 0, 0, false
+	for i := 0; i < len(where); i++ {
+		switch c := where[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '\'':
+			quoted = !quoted
+		case !quoted && c == '(':
+			depth++
+		case !quoted && c == ')':
+			depth--
+		case !quoted && depth == 0:
+			if loc := andPattern.FindStringIndex(where[i:]); loc != nil {
+				parts = append(parts, where[start:i])
+				start = i + loc[1]
+				i = start - 1
+			}
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, errors.New("unexpected where clause: " + where)
+	}
+	return append(parts, where[start:]), nil
+}
+
+func parseCondition(s string) (*condition, error) {
+	m := conditionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil, errors.New("unexpected condition: " + s)
+	}
+	c := &condition{field: m[1]}
+	operator := strings.ToLower(strings.Join(strings.Fields(m[2]), " "))
+	c.negate = operator == "!=" || operator == "not in"
+	list := m[3]
+	if operator == "in" || operator == "not in" {
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return nil, errors.New("unexpected condition: " + s)
+		}
+		list = list[1 : len(list)-1]
+	}
+	for len(strings.TrimSpace(list)) > 0 {
+		var v *string
+		var err error
+		v, list, err = parseValue(strings.TrimSpace(list))
+		if err != nil {
+			return nil, errors.New("unexpected condition: " + s)
+		}
+		c.values = append(c.values, v)
+		list = strings.TrimSpace(list)
+		if strings.HasPrefix(list, ",") {
+			list = list[1:]
+		} else if list != "" {
+			return nil, errors.New("unexpected condition: " + s)
+		}
+	}
+	return c, nil
+}
+
+// parseValue returns first literal of the string and the rest of it
+func parseValue(s string) (*string, string, error) {
+	if strings.HasPrefix(s, "'") {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
+				}
+			case '\'':
+				v := b.String()
+				return &v, s[i+1:], nil
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		return nil, "", errors.New("unterminated string")
+	}
+	end := strings.IndexAny(s, ", ")
+	if end < 0 {
+		end = len(s)
+	}
+	v := s[:end]
+	if strings.EqualFold(v, "null") {
+		return nil, s[end:], nil
+	}
+	return &v, s[end:], nil
+}
@@ -0,0 +1,295 @@
+package forcetest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// restError is error returned by rest api, either for a request or for a record of collection
+type restError struct {
+	StatusCode string   `json:"statusCode,omitempty"`
+	ErrorCode  string   `json:"errorCode,omitempty"`
+	Message    string   `json:"message"`
+	Fields     []string `json:"fields,omitempty"`
+}
+
+type restResult struct {
+	Id      *string `json:"id"`
+	Success bool    `json:"success"`
+	// created is returned only by upsert
+	Created *bool        `json:"created,omitempty"`
+	Errors  []*restError `json:"errors"`
+}
+
+// serveRest serves rest query, sObject collections and sObject tree calls, paths are relative to /services/data/vXX.X
+func (s *Server) serveRest(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/services/data/"), "/", 2)
+	path := ""
+	if len(parts) == 2 {
+		path = "/" + parts[1]
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls[r.Method+" "+strings.SplitN(path+"/", "/", 3)[1]]++
+	if path != "/limits" {
+		s.ApiRequests++
+	}
+	w.Header().Set("Sforce-Limit-Info", fmt.Sprint("api-usage=", s.ApiRequests, "/", s.DailyApiRequests))
+	if r.Header.Get("Authorization") != "Bearer "+SESSION_ID {
+		writeJson(w, http.StatusUnauthorized, []*restError{&restError{ErrorCode: "INVALID_SESSION_ID", Message: "Session expired or invalid"}})
+		return
+	}
+	switch {
+	case r.Method == "GET" && path == "/limits":
+		writeJson(w, http.StatusOK, map[string]interface{}{
+			"DailyApiRequests": map[string]int{"Max": s.DailyApiRequests, "Remaining": s.DailyApiRequests - s.ApiRequests},
+		})
+	case r.Method == "GET" && (path == "/query" || path == "/queryAll"):
+		c, fault := s.runQuery(r.URL.Query().Get("q"), path == "/queryAll")
+		if fault != nil {
+			writeJson(w, http.StatusBadRequest, []*restError{&restError{ErrorCode: fault.code, Message: fault.message}})
+			return
+		}
+		writeJson(w, http.StatusOK, s.restQueryResult(parts[0], c))
+	case r.Method == "GET" && (strings.HasPrefix(path, "/query/") || strings.HasPrefix(path, "/queryAll/")):
+		locator := path[strings.LastIndex(path, "/")+1:]
+		c, ok := s.cursors[locator]
+		if !ok {
+			writeJson(w, http.StatusBadRequest, []*restError{&restError{ErrorCode: "INVALID_QUERY_LOCATOR", Message: "invalid query locator"}})
+			return
+		}
+		delete(s.cursors, locator)
+		writeJson(w, http.StatusOK, s.restQueryResult(parts[0], c))
+	case r.Method == "DELETE" && path == "/composite/sobjects":
+		results := make([]*restResult, 0)
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			results = append(results, restSaveResult(id, s.deleteRecord(id)))
+		}
+		writeJson(w, http.StatusOK, results)
+	case (r.Method == "POST" || r.Method == "PATCH") && strings.HasPrefix(path, "/composite/sobjects"):
+		var body struct {
+			AllOrNone bool                     `json:"allOrNone"`
+			Records   []map[string]interface{} `json:"records"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			writeJson(w, http.StatusBadRequest, []*restError{&restError{ErrorCode: "JSON_PARSER_ERROR", Message: err.Error()}})
+			return
+		}
+		operation, externalId := "create", ""
+		if r.Method == "PATCH" {
+			operation = "update"
+			if p := strings.Split(path, "/"); len(p) == 5 {
+				operation, externalId = "upsert", p[4]
+			}
+		}
+		results := make([]*restResult, 0, len(body.Records))
+		for _, record := range body.Records {
+			id, created, e := s.saveRecord(operation, externalId, jsonNode(record))
+			result := restSaveResult(id, e)
+			if operation == "upsert" {
+				result.Created = &created
+			}
+			results = append(results, result)
+		}
+		writeJson(w, http.StatusOK, results)
+	case r.Method == "POST" && strings.HasPrefix(path, "/composite/tree/"):
+		var body struct {
+			Records []map[string]interface{} `json:"records"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			writeJson(w, http.StatusBadRequest, []*restError{&restError{ErrorCode: "JSON_PARSER_ERROR", Message: err.Error()}})
+			return
+		}
+		result := s.saveTree(body.Records)
+		if result.HasErrors {
+			writeJson(w, http.StatusBadRequest, result)
+		} else {
+			writeJson(w, http.StatusCreated, result)
+		}
+	default:
+		writeJson(w, http.StatusNotFound, []*restError{&restError{ErrorCode: "NOT_FOUND", Message: "The requested resource does not exist"}})
+	}
+}
+
+type treeResult struct {
+	HasErrors bool              `json:"hasErrors"`
+	Results   []*treeItemResult `json:"results"`
+}
+
+type treeItemResult struct {
+	ReferenceId string       `json:"referenceId"`
+	Id          string       `json:"id,omitempty"`
+	Errors      []*restError `json:"errors,omitempty"`
+}
+
+// saveTree creates parent records with their children, children are linked to the parent by the first reference
+// field pointing to the object of the parent. Trees are saved all or none, only errors are returned on failure.
+func (s *Server) saveTree(records []map[string]interface{}) *treeResult {
+	sizes := make(map[*object]int)
+	for _, obj := range s.objects {
+		sizes[obj] = len(obj.records)
+	}
+	result := &treeResult{Results: make([]*treeItemResult, 0)}
+	failed := &treeResult{HasErrors: true, Results: make([]*treeItemResult, 0)}
+	save := func(record map[string]interface{}, parentField string, parentId string) string {
+		ref := ""
+		if attributes, ok := record["attributes"].(map[string]interface{}); ok {
+			ref = fmt.Sprint(attributes["referenceId"])
+		}
+		n := jsonNode(record)
+		if parentField != "" {
+			n.Children = append(n.Children, &node{XMLName: xml.Name{Local: parentField}, Text: parentId})
+		}
+		id, _, e := s.saveRecord("create", "", n)
+		if e != nil {
+			failed.Results = append(failed.Results, &treeItemResult{ReferenceId: ref, Errors: []*restError{&restError{StatusCode: e.code, Message: e.message, Fields: e.fields}}})
+			return ""
+		}
+		result.Results = append(result.Results, &treeItemResult{ReferenceId: ref, Id: id})
+		return id
+	}
+	for _, record := range records {
+		fields := make(map[string]interface{})
+		related := make(map[string][]interface{})
+		for name, value := range record {
+			if m, ok := value.(map[string]interface{}); ok && name != "attributes" {
+				if children, ok := m["records"].([]interface{}); ok {
+					related[name] = children
+					continue
+				}
+			}
+			fields[name] = value
+		}
+		parentId := save(fields, "", "")
+		parentType := jsonNode(fields).text("type")
+		for _, children := range related {
+			for _, c := range children {
+				child, _ := c.(map[string]interface{})
+				parentField := ""
+				if obj, ok := s.objects[strings.ToLower(jsonNode(child).text("type"))]; ok {
+					for _, fd := range obj.Fields {
+						if fd.Type == "reference" && strings.EqualFold(fd.ReferenceTo, parentType) {
+							parentField = fd.Name
+							break
+						}
+					}
+				}
+				save(child, parentField, parentId)
+			}
+		}
+	}
+	if len(failed.Results) > 0 {
+		for obj, size := range sizes {
+			obj.records = obj.records[:size]
+		}
+		return failed
+	}
+	return result
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func restSaveResult(id string, e *saveError) *restResult {
+	result := &restResult{Success: e == nil, Errors: make([]*restError, 0)}
+	if id != "" {
+		result.Id = &id
+	}
+	if e != nil {
+		result.Errors = append(result.Errors, &restError{StatusCode: e.code, Message: e.message, Fields: e.fields})
+	}
+	return result
+}
+
+// jsonNode converts json record to the same form as soap request, so it could be saved the same way
+func jsonNode(record map[string]interface{}) *node {
+	n := &node{}
+	for name, value := range record {
+		if name == "attributes" {
+			if attributes, ok := value.(map[string]interface{}); ok {
+				n.Children = append(n.Children, &node{XMLName: xml.Name{Local: "type"}, Text: fmt.Sprint(attributes["type"])})
+			}
+			continue
+		}
+		var child *node
+		switch value.(type) {
+		case nil:
+			child = &node{Attrs: []xml.Attr{xml.Attr{Name: xml.Name{Local: "nil"}, Value: "true"}}}
+		case map[string]interface{}:
+			child = jsonNode(value.(map[string]interface{}))
+		default:
+			child = &node{Text: fmt.Sprint(value)}
+		}
+		child.XMLName = xml.Name{Local: name}
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
+
+func (s *Server) restQueryResult(version string, c *cursor) map[string]interface{} {
+	rows, locator := s.page(c)
+	records := make([]interface{}, 0, len(rows))
+	for _, r := range rows {
+		records = append(records, s.jsonRecord(version, c.object, r, c.fields))
+	}
+	result := map[string]interface{}{"totalSize": c.size, "done": locator == "", "records": records}
+	if locator != "" {
+		result["nextRecordsUrl"] = "/services/data/" + version + "/query/" + locator
+	}
+	return result
+}
+
+func (s *Server) jsonRecord(version string, obj *object, r map[string]string, fields []string) map[string]interface{} {
+	m := map[string]interface{}{
+		"attributes": map[string]interface{}{"type": obj.Name, "url": "/services/data/" + version + "/sobjects/" + obj.Name + "/" + r["id"]},
+	}
+	for _, f := range fields {
+		parts := strings.SplitN(f, ".", 2)
+		if len(parts) == 1 {
+			fd, _ := obj.field(f)
+			m[fd.Name] = jsonValue(fd, r[strings.ToLower(f)])
+			continue
+		}
+		rel, _ := obj.relationship(parts[0])
+		if _, ok := m[rel.RelationshipName]; ok {
+			continue
+		}
+		parent := s.objects[strings.ToLower(rel.ReferenceTo)]
+		pr := parent.find(r[strings.ToLower(rel.Name)])
+		if pr == nil {
+			m[rel.RelationshipName] = nil
+			continue
+		}
+		nested := make([]string, 0)
+		for _, nf := range fields {
+			if np := strings.SplitN(nf, ".", 2); len(np) == 2 && strings.EqualFold(np[0], parts[0]) {
+				nested = append(nested, np[1])
+			}
+		}
+		m[rel.RelationshipName] = s.jsonRecord(version, parent, pr, nested)
+	}
+	return m
+}
+
+func jsonValue(fd *Field, value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	switch fd.Type {
+	case "boolean":
+		return value == "true"
+	case "int", "double", "currency", "percent":
+		return json.Number(value)
+	}
+	return value
+}
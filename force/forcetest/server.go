@@ -0,0 +1,1082 @@
+// Package forcetest provides in-memory salesforce instance serving soap api calls used by reloader.
+// It is intended for tests of force package and jobs, it is not a complete implementation of the api.
+package forcetest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	USERNAME   string = "user@example.com"
+	PASSWORD   string = "password"
+	SESSION_ID string = "00D000000000001!session"
+	// default number of records returned by query and queryMore calls
+	QUERY_BATCH_SIZE int = 2000
+	// default daily api requests limit
+	DAILY_API_REQUESTS int = 15000
+)
+
+// Field describes field of an object, Id field is added to every object.
+type Field struct {
+	Name             string
+	Type             string
+	Length           int
+	ReferenceTo      string
+	RelationshipName string
+	Picklist         []string
+	// only values of the picklist are accepted
+	Restricted bool
+	ExternalId bool
+	Required   bool
+	// field is neither createable nor updateable
+	ReadOnly bool
+	// formula field, it is read only and calculated
+	Formula bool
+}
+
+// Object is definition of sObject with seed records, records are maps of field names to values.
+// Seed records without Id get generated Id.
+type Object struct {
+	Name    string
+	Prefix  string
+	Fields  []*Field
+	Records []map[string]string
+}
+
+type Server struct {
+	*httptest.Server
+	QueryBatchSize int
+	// daily api requests limit, all calls except login and limits are counted as api requests
+	DailyApiRequests int
+	ApiRequests      int
+	lock             sync.Mutex
+	objects          map[string]*object
+	names            []string
+	seq              int
+	cursors          map[string]*cursor
+	calls            map[string]int
+}
+
+type object struct {
+	*Object
+	records []map[string]string
+	// deleted records in recycle bin
+	deleted []map[string]string
+}
+
+type cursor struct {
+	size   int
+	object *object
+	fields []string
+	rows   []map[string]string
+}
+
+// NewServer starts server with objects, it should be closed after use.
+func NewServer(objects ...*Object) *Server {
+	s := &Server{
+		QueryBatchSize:   QUERY_BATCH_SIZE,
+		DailyApiRequests: DAILY_API_REQUESTS,
+		objects:          make(map[string]*object),
+		cursors:          make(map[string]*cursor),
+		calls:            make(map[string]int),
+	}
+	for i, o := range objects {
+		obj := &object{Object: o, records: make([]map[string]string, 0, len(o.Records))}
+		if obj.Prefix == "" {
+			obj.Prefix = fmt.Sprintf("a%02d", i)
+		}
+		if _, ok := obj.field("Id"); !ok {
+			obj.Fields = append([]*Field{&Field{Name: "Id", Type: "id", ReadOnly: true}}, obj.Fields...)
+		}
+		s.objects[strings.ToLower(o.Name)] = obj
+		s.names = append(s.names, o.Name)
+	}
+	for _, name := range s.names {
+		obj := s.objects[strings.ToLower(name)]
+		for _, seed := range obj.Object.Records {
+			record := make(map[string]string)
+			for k, v := range seed {
+				record[strings.ToLower(k)] = v
+			}
+			if record["id"] == "" {
+				record["id"] = s.newId(obj)
+			}
+			obj.records = append(obj.records, record)
+		}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Records returns copy of current records of the object with field names as defined.
+func (s *Server) Records(sObject string) []map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	obj, ok := s.objects[strings.ToLower(sObject)]
+	if !ok {
+		return nil
+	}
+	return obj.copy(obj.records)
+}
+
+// Deleted returns copy of records of the object in recycle bin.
+func (s *Server) Deleted(sObject string) []map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	obj, ok := s.objects[strings.ToLower(sObject)]
+	if !ok {
+		return nil
+	}
+	return obj.copy(obj.deleted)
+}
+
+func (obj *object) copy(rows []map[string]string) []map[string]string {
+	records := make([]map[string]string, 0, len(rows))
+	for _, r := range rows {
+		record := make(map[string]string)
+		for _, f := range obj.Fields {
+			if v, ok := r[strings.ToLower(f.Name)]; ok {
+				record[f.Name] = v
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Calls returns number of calls of soap operation, like create or query, or of rest resource, like GET query.
+func (s *Server) Calls(operation string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[operation]
+}
+
+func (o *object) field(name string) (*Field, bool) {
+	for _, f := range o.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (o *object) relationship(name string) (*Field, bool) {
+	for _, f := range o.Fields {
+		if f.RelationshipName != "" && strings.EqualFold(f.RelationshipName, name) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (o *object) find(id string) map[string]string {
+	for _, r := range o.records {
+		if sameId(r["id"], id) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Server) newId(obj *object) string {
+	s.seq++
+	return fmt.Sprintf("%s%012dAAA", obj.Prefix, s.seq)
+}
+
+func sameId(a string, b string) bool {
+	if len(a) >= 15 && len(b) >= 15 {
+		return a[:15] == b[:15]
+	}
+	return a == b
+}
+
+// node is generic xml element of request
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []*node    `xml:",any"`
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.Children {
+		if strings.EqualFold(c.XMLName.Local, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *node) all(name string) []*node {
+	nodes := make([]*node, 0)
+	for _, c := range n.Children {
+		if strings.EqualFold(c.XMLName.Local, name) {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+func (n *node) text(name string) string {
+	if c := n.child(name); c != nil {
+		return strings.TrimSpace(c.Text)
+	}
+	return ""
+}
+
+func (n *node) isNil() bool {
+	for _, a := range n.Attrs {
+		if a.Name.Local == "nil" && a.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+type soapError struct {
+	code    string
+	message string
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/services/data/") {
+		s.serveRest(w, r)
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeFault(w, "UNKNOWN_EXCEPTION", err.Error())
+		return
+	}
+	var envelope node
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		writeFault(w, "INVALID_XML", err.Error())
+		return
+	}
+	body := envelope.child("Body")
+	if body == nil || len(body.Children) == 0 {
+		writeFault(w, "INVALID_XML", "no soap body")
+		return
+	}
+	request := body.Children[0]
+	operation := request.XMLName.Local
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls[operation]++
+	if operation != "login" {
+		s.ApiRequests++
+		header := envelope.child("Header")
+		if header == nil || header.child("SessionHeader") == nil || header.child("SessionHeader").text("sessionId") != SESSION_ID {
+			writeFault(w, "INVALID_SESSION_ID", "Invalid Session ID found in SessionHeader")
+			return
+		}
+	}
+	var response string
+	var fault *soapError
+	switch operation {
+	case "login":
+		response, fault = s.login(request)
+	case "describeSObject":
+		response, fault = s.describeSObject(request)
+	case "query", "queryAll":
+		response, fault = s.query(operation, request)
+	case "queryMore":
+		response, fault = s.queryMore(request)
+	case "create", "update", "upsert":
+		response, fault = s.save(operation, request)
+	case "delete":
+		response, fault = s.delete(request)
+	case "undelete":
+		response, fault = s.undelete(request)
+	case "emptyRecycleBin":
+		response, fault = s.emptyRecycleBin(request)
+	case "merge":
+		response, fault = s.merge(request)
+	case "convertLead":
+		response, fault = s.convertLead(request)
+	default:
+		fault = &soapError{"UNSUPPORTED_API_OPERATION", "operation not supported: " + operation}
+	}
+	if fault != nil {
+		writeFault(w, fault.code, fault.message)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+
+		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" `+
+		`xmlns="urn:partner.soap.sforce.com" xmlns:sf="urn:sobject.partner.soap.sforce.com" `+
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><soapenv:Body>`,
+		response, `</soapenv:Body></soapenv:Envelope>`)
+}
+
+func writeFault(w http.ResponseWriter, code string, message string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+
+		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" `+
+		`xmlns:sf="urn:fault.partner.soap.sforce.com"><soapenv:Body><soapenv:Fault>`+
+		`<faultcode>sf:`, code, `</faultcode><faultstring>`, code, `: `, escape(message), `</faultstring>`+
+		`</soapenv:Fault></soapenv:Body></soapenv:Envelope>`)
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func element(name string, value string) string {
+	return "<" + name + ">" + escape(value) + "</" + name + ">"
+}
+
+func nilElement(name string) string {
+	return "<" + name + ` xsi:nil="true"/>`
+}
+
+func (s *Server) login(request *node) (string, *soapError) {
+	if request.text("username") != USERNAME || request.text("password") != PASSWORD {
+		return "", &soapError{"INVALID_LOGIN", "Invalid username, password, security token; or user locked out."}
+	}
+	serverUrl := s.URL + "/services/Soap/u/42.0/00D000000000001"
+	return "<loginResponse><result>" +
+		element("metadataServerUrl", s.URL+"/services/Soap/m/42.0/00D000000000001") +
+		element("passwordExpired", "false") +
+		element("sandbox", "true") +
+		element("serverUrl", serverUrl) +
+		element("sessionId", SESSION_ID) +
+		element("userId", "005000000000001AAA") +
+		"</result></loginResponse>", nil
+}
+
+var soapTypes = map[string]string{
+	"id":        "tns:ID",
+	"reference": "tns:ID",
+	"boolean":   "xsd:boolean",
+	"int":       "xsd:int",
+	"double":    "xsd:double",
+	"currency":  "xsd:double",
+	"percent":   "xsd:double",
+	"date":      "xsd:date",
+	"datetime":  "xsd:dateTime",
+	"base64":    "xsd:base64Binary",
+}
+
+func (s *Server) describeSObject(request *node) (string, *soapError) {
+	obj, ok := s.objects[strings.ToLower(request.text("sObjectType"))]
+	if !ok {
+		return "", &soapError{"INVALID_TYPE", "sObject type '" + request.text("sObjectType") + "' is not supported."}
+	}
+	var b bytes.Buffer
+	b.WriteString("<describeSObjectResponse><result>")
+	b.WriteString(element("createable", "true"))
+	b.WriteString(element("deletable", "true"))
+	b.WriteString(element("keyPrefix", obj.Prefix))
+	b.WriteString(element("label", obj.Name))
+	b.WriteString(element("name", obj.Name))
+	b.WriteString(element("queryable", "true"))
+	b.WriteString(element("updateable", "true"))
+	for _, f := range obj.Fields {
+		soapType, ok := soapTypes[f.Type]
+		if !ok {
+			soapType = "xsd:string"
+		}
+		length := f.Length
+		if length == 0 && soapType == "xsd:string" {
+			length = 255
+		}
+		idLookup := f.Type == "id" || f.ExternalId
+		b.WriteString("<fields>")
+		b.WriteString(element("autoNumber", "false"))
+		b.WriteString(element("byteLength", fmt.Sprint(length*3)))
+		b.WriteString(element("calculated", fmt.Sprint(f.Formula)))
+		b.WriteString(element("createable", fmt.Sprint(!f.ReadOnly && !f.Formula)))
+		b.WriteString(element("custom", fmt.Sprint(strings.HasSuffix(f.Name, "__c"))))
+		b.WriteString(element("defaultedOnCreate", fmt.Sprint(f.Type == "id" || f.Type == "boolean")))
+		b.WriteString(element("externalId", fmt.Sprint(f.ExternalId)))
+		b.WriteString(element("idLookup", fmt.Sprint(idLookup)))
+		b.WriteString(element("label", f.Name))
+		b.WriteString(element("length", fmt.Sprint(length)))
+		b.WriteString(element("name", f.Name))
+		b.WriteString(element("nillable", fmt.Sprint(!f.Required && f.Type != "id" && f.Type != "boolean")))
+		for _, v := range f.Picklist {
+			b.WriteString("<picklistValues>" + element("active", "true") + element("defaultValue", "false") +
+				element("label", v) + element("value", v) + "</picklistValues>")
+		}
+		if f.ReferenceTo != "" {
+			b.WriteString(element("referenceTo", f.ReferenceTo))
+		}
+		if f.RelationshipName != "" {
+			b.WriteString(element("relationshipName", f.RelationshipName))
+		}
+		if f.Type == "picklist" {
+			b.WriteString(element("restrictedPicklist", fmt.Sprint(f.Restricted)))
+		}
+		b.WriteString(element("soapType", soapType))
+		b.WriteString(element("type", f.Type))
+		b.WriteString(element("unique", fmt.Sprint(f.ExternalId)))
+		b.WriteString(element("updateable", fmt.Sprint(!f.ReadOnly && !f.Formula && f.Type != "id")))
+		b.WriteString("</fields>")
+	}
+	b.WriteString("</result></describeSObjectResponse>")
+	return b.String(), nil
+}
+
+// query serves query and queryAll, queryAll returns deleted records too
+func (s *Server) query(operation string, request *node) (string, *soapError) {
+	c, fault := s.runQuery(request.text("queryString"), operation == "queryAll")
+	if fault != nil {
+		return "", fault
+	}
+	return s.queryResult(operation+"Response", c)
+}
+
+func (s *Server) runQuery(soql string, all bool) (*cursor, *soapError) {
+	q, err := parseQuery(soql)
+	if err != nil {
+		return nil, &soapError{"MALFORMED_QUERY", err.Error()}
+	}
+	obj, ok := s.objects[strings.ToLower(q.sObject)]
+	if !ok {
+		return nil, &soapError{"INVALID_TYPE", "sObject type '" + q.sObject + "' is not supported."}
+	}
+	for _, f := range q.fields {
+		if _, err := s.value(obj, map[string]string{}, f); err != nil {
+			return nil, &soapError{"INVALID_FIELD", err.Error()}
+		}
+	}
+	rows := make([]map[string]string, 0)
+	records := obj.records
+	if all {
+		records = append(append([]map[string]string{}, obj.records...), obj.deleted...)
+	}
+	for _, r := range records {
+		match, err := s.matches(obj, r, q.conditions)
+		if err != nil {
+			return nil, &soapError{"INVALID_FIELD", err.Error()}
+		}
+		if match {
+			rows = append(rows, r)
+		}
+	}
+	if q.limit >= 0 && len(rows) > q.limit {
+		rows = rows[:q.limit]
+	}
+	return &cursor{size: len(rows), object: obj, fields: q.fields, rows: rows}, nil
+}
+
+func (s *Server) queryMore(request *node) (string, *soapError) {
+	locator := request.text("queryLocator")
+	c, ok := s.cursors[locator]
+	if !ok {
+		return "", &soapError{"INVALID_QUERY_LOCATOR", "invalid query locator"}
+	}
+	delete(s.cursors, locator)
+	return s.queryResult("queryMoreResponse", c)
+}
+
+// page returns rows of the next batch of cursor and query locator of the rest, locator is empty if query is done.
+func (s *Server) page(c *cursor) ([]map[string]string, string) {
+	if len(c.rows) <= s.QueryBatchSize {
+		return c.rows, ""
+	}
+	s.seq++
+	locator := fmt.Sprintf("01g%012dAAA-%d", s.seq, s.QueryBatchSize)
+	s.cursors[locator] = &cursor{size: c.size, object: c.object, fields: c.fields, rows: c.rows[s.QueryBatchSize:]}
+	return c.rows[:s.QueryBatchSize], locator
+}
+
+func (s *Server) queryResult(response string, c *cursor) (string, *soapError) {
+	var b bytes.Buffer
+	rows, locator := s.page(c)
+	done := locator == ""
+	b.WriteString("<" + response + `><result xsi:type="QueryResult">`)
+	b.WriteString(element("done", fmt.Sprint(done)))
+	if done {
+		b.WriteString(nilElement("queryLocator"))
+	} else {
+		b.WriteString(element("queryLocator", locator))
+	}
+	for _, r := range rows {
+		b.WriteString(`<records xsi:type="sf:sObject">`)
+		s.writeRecord(&b, c.object, r, c.fields)
+		b.WriteString("</records>")
+	}
+	b.WriteString(element("size", fmt.Sprint(c.size)))
+	b.WriteString("</result></" + response + ">")
+	return b.String(), nil
+}
+
+// writeRecord writes fields of record the way partner api does: type, Id and queried fields with
+// relationship fields as nested sObjects.
+func (s *Server) writeRecord(b *bytes.Buffer, obj *object, r map[string]string, fields []string) {
+	b.WriteString(element("sf:type", obj.Name))
+	selected := false
+	for _, f := range fields {
+		selected = selected || strings.EqualFold(f, "Id")
+	}
+	if selected && r["id"] != "" {
+		b.WriteString(element("sf:Id", r["id"]))
+	} else {
+		b.WriteString(nilElement("sf:Id"))
+	}
+	written := make(map[string]bool)
+	for _, f := range fields {
+		parts := strings.SplitN(f, ".", 2)
+		if len(parts) == 1 {
+			fd, _ := obj.field(f)
+			if v, ok := r[strings.ToLower(f)]; ok && v != "" {
+				b.WriteString(element("sf:"+fd.Name, v))
+			} else {
+				b.WriteString(nilElement("sf:" + fd.Name))
+			}
+			continue
+		}
+		rel, _ := obj.relationship(parts[0])
+		if written[strings.ToLower(rel.RelationshipName)] {
+			continue
+		}
+		written[strings.ToLower(rel.RelationshipName)] = true
+		parent := s.objects[strings.ToLower(rel.ReferenceTo)]
+		pr := parent.find(r[strings.ToLower(rel.Name)])
+		if pr == nil {
+			b.WriteString(nilElement("sf:" + rel.RelationshipName))
+			continue
+		}
+		// all fields of the same relationship go into one nested record
+		nested := make([]string, 0)
+		for _, nf := range fields {
+			if np := strings.SplitN(nf, ".", 2); len(np) == 2 && strings.EqualFold(np[0], parts[0]) {
+				nested = append(nested, np[1])
+			}
+		}
+		b.WriteString("<sf:" + rel.RelationshipName + ` xsi:type="sf:sObject">`)
+		s.writeRecord(b, parent, pr, nested)
+		b.WriteString("</sf:" + rel.RelationshipName + ">")
+	}
+}
+
+// value returns value of field of the record, relationship fields are followed.
+func (s *Server) value(obj *object, r map[string]string, field string) (string, error) {
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) == 1 {
+		if _, ok := obj.field(field); !ok {
+			return "", errors.New(fmt.Sprint("No such column '", field, "' on entity '", obj.Name, "'"))
+		}
+		return r[strings.ToLower(field)], nil
+	}
+	rel, ok := obj.relationship(parts[0])
+	if !ok {
+		return "", errors.New(fmt.Sprint("Didn't understand relationship '", parts[0], "' in field path"))
+	}
+	parent, ok := s.objects[strings.ToLower(rel.ReferenceTo)]
+	if !ok {
+		return "", errors.New(fmt.Sprint("Didn't understand relationship '", parts[0], "' in field path"))
+	}
+	pr := parent.find(r[strings.ToLower(rel.Name)])
+	if pr == nil {
+		pr = map[string]string{}
+	}
+	return s.value(parent, pr, parts[1])
+}
+
+func (s *Server) matches(obj *object, r map[string]string, conditions []*condition) (bool, error) {
+	for _, c := range conditions {
+		v, err := s.value(obj, r, c.field)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, cv := range c.values {
+			if cv == nil {
+				found = found || v == ""
+			} else {
+				found = found || strings.EqualFold(v, *cv) || sameId(v, *cv) && len(v) >= 15
+			}
+		}
+		if found == c.negate {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// saveError is error of a record returned by dml operations
+type saveError struct {
+	code    string
+	message string
+	fields  []string
+}
+
+func newError(code string, message string, fields ...string) *saveError {
+	return &saveError{code: code, message: message, fields: fields}
+}
+
+func (e *saveError) xml() string {
+	var b bytes.Buffer
+	b.WriteString("<errors>")
+	for _, f := range e.fields {
+		b.WriteString(element("fields", f))
+	}
+	b.WriteString(element("message", e.message))
+	b.WriteString(element("statusCode", e.code))
+	b.WriteString("</errors>")
+	return b.String()
+}
+
+func (s *Server) save(operation string, request *node) (string, *soapError) {
+	externalId := request.text("externalIDFieldName")
+	var b bytes.Buffer
+	b.WriteString("<" + operation + "Response>")
+	for _, sObject := range request.all("sObjects") {
+		id, created, e := s.saveRecord(operation, externalId, sObject)
+		b.WriteString("<result>")
+		if operation == "upsert" {
+			b.WriteString(element("created", fmt.Sprint(created)))
+		}
+		if e != nil {
+			b.WriteString(e.xml())
+		}
+		if id != "" {
+			b.WriteString(element("id", id))
+		} else {
+			b.WriteString(nilElement("id"))
+		}
+		b.WriteString(element("success", fmt.Sprint(e == nil)))
+		b.WriteString("</result>")
+	}
+	b.WriteString("</" + operation + "Response>")
+	return b.String(), nil
+}
+
+func (s *Server) saveRecord(operation string, externalId string, sObject *node) (id string, created bool, err *saveError) {
+	obj, ok := s.objects[strings.ToLower(sObject.text("type"))]
+	if !ok {
+		return "", false, newError("INVALID_TYPE", "sObject type '"+sObject.text("type")+"' is not supported.")
+	}
+	values := make(map[string]*string)
+	for _, n := range sObject.all("fieldsToNull") {
+		values[strings.ToLower(strings.TrimSpace(n.Text))] = nil
+	}
+	for _, n := range sObject.Children {
+		name := n.XMLName.Local
+		if strings.EqualFold(name, "type") || strings.EqualFold(name, "fieldsToNull") {
+			continue
+		}
+		if len(n.Children) > 0 {
+			// reference by external id of the parent
+			rel, ok := obj.relationship(name)
+			if !ok {
+				return "", false, newError("INVALID_FIELD", "No such column '"+name+"' on entity '"+obj.Name+"'", name)
+			}
+			parentId, e := s.resolveReference(rel, n)
+			if e != nil {
+				return "", false, e
+			}
+			values[strings.ToLower(rel.Name)] = &parentId
+			continue
+		}
+		if n.isNil() {
+			values[strings.ToLower(name)] = nil
+			continue
+		}
+		v := n.Text
+		values[strings.ToLower(name)] = &v
+	}
+	// find record to update
+	var record map[string]string
+	switch operation {
+	case "update":
+		if v := values["id"]; v != nil {
+			record = obj.find(*v)
+		}
+		if record == nil {
+			return "", false, newError("INVALID_CROSS_REFERENCE_KEY", "invalid cross reference id", "Id")
+		}
+	case "upsert":
+		fd, ok := obj.field(externalId)
+		if !ok || !(fd.ExternalId || fd.Type == "id") {
+			return "", false, newError("INVALID_FIELD", "Field name provided, "+externalId+" is not an External ID or indexed field for "+obj.Name)
+		}
+		key := values[strings.ToLower(externalId)]
+		if key == nil || *key == "" {
+			if fd.Type != "id" {
+				return "", false, newError("MISSING_ARGUMENT", externalId+" not specified")
+			}
+		} else {
+			found := make([]map[string]string, 0)
+			for _, r := range obj.records {
+				if strings.EqualFold(r[strings.ToLower(fd.Name)], *key) || fd.Type == "id" && sameId(r["id"], *key) {
+					found = append(found, r)
+				}
+			}
+			if len(found) > 1 {
+				return "", false, newError("DUPLICATE_EXTERNAL_ID", "Duplicate external id specified: "+*key, externalId)
+			}
+			if len(found) == 1 {
+				record = found[0]
+			} else if fd.Type == "id" {
+				return "", false, newError("INVALID_CROSS_REFERENCE_KEY", "invalid cross reference id", "Id")
+			}
+		}
+	}
+	creating := record == nil
+	// validate values
+	for name, v := range values {
+		fd, ok := obj.field(name)
+		if !ok {
+			return "", false, newError("INVALID_FIELD", "No such column '"+name+"' on entity '"+obj.Name+"'", name)
+		}
+		if fd.Type == "id" {
+			continue
+		}
+		if fd.ReadOnly || fd.Formula {
+			return "", false, newError("INVALID_FIELD_FOR_INSERT_UPDATE", "Unable to create/update fields: "+fd.Name, fd.Name)
+		}
+		if v == nil || *v == "" {
+			if fd.Required {
+				return "", false, newError("REQUIRED_FIELD_MISSING", "Required fields are missing: ["+fd.Name+"]", fd.Name)
+			}
+			continue
+		}
+		if fd.Length > 0 && len([]rune(*v)) > fd.Length {
+			return "", false, newError("STRING_TOO_LONG", fd.Name+": data value too large: "+*v, fd.Name)
+		}
+		if fd.Type == "picklist" && fd.Restricted && !contains(fd.Picklist, *v) {
+			return "", false, newError("INVALID_OR_NULL_FOR_RESTRICTED_PICKLIST", fd.Name+": bad value for restricted picklist field: "+*v, fd.Name)
+		}
+		if fd.Type == "reference" && fd.ReferenceTo != "" {
+			if parent, ok := s.objects[strings.ToLower(fd.ReferenceTo)]; ok && parent.find(*v) == nil {
+				return "", false, newError("INVALID_CROSS_REFERENCE_KEY", fd.Name+": id value of incorrect type: "+*v, fd.Name)
+			}
+		}
+	}
+	if creating {
+		for _, fd := range obj.Fields {
+			if v, ok := values[strings.ToLower(fd.Name)]; fd.Required && (!ok || v == nil || *v == "") {
+				return "", false, newError("REQUIRED_FIELD_MISSING", "Required fields are missing: ["+fd.Name+"]", fd.Name)
+			}
+		}
+		record = map[string]string{"id": s.newId(obj)}
+		obj.records = append(obj.records, record)
+	}
+	for name, v := range values {
+		if name == "id" {
+			continue
+		}
+		if v == nil {
+			delete(record, name)
+		} else {
+			record[name] = *v
+		}
+	}
+	return record["id"], creating, nil
+}
+
+func (s *Server) resolveReference(rel *Field, n *node) (string, *saveError) {
+	parent, ok := s.objects[strings.ToLower(rel.ReferenceTo)]
+	if t := n.text("type"); t != "" {
+		parent, ok = s.objects[strings.ToLower(t)]
+	}
+	if !ok {
+		return "", newError("INVALID_FIELD", "unknown object of relationship "+rel.RelationshipName, rel.Name)
+	}
+	for _, c := range n.Children {
+		if strings.EqualFold(c.XMLName.Local, "type") {
+			continue
+		}
+		fd, ok := parent.field(c.XMLName.Local)
+		if !ok || !fd.ExternalId {
+			return "", newError("INVALID_FIELD", "Field name provided, "+c.XMLName.Local+" is not an External ID or indexed field for "+parent.Name, rel.Name)
+		}
+		for _, r := range parent.records {
+			if strings.EqualFold(r[strings.ToLower(fd.Name)], c.Text) {
+				return r["id"], nil
+			}
+		}
+		return "", newError("INVALID_FIELD", "Foreign key external ID: "+c.Text+" not found for field "+fd.Name+" in entity "+parent.Name, rel.Name)
+	}
+	return "", newError("INVALID_FIELD", "no external id provided for relationship "+rel.RelationshipName, rel.Name)
+}
+
+func (s *Server) delete(request *node) (string, *soapError) {
+	var b bytes.Buffer
+	b.WriteString("<deleteResponse>")
+	for _, n := range request.all("ids") {
+		id := strings.TrimSpace(n.Text)
+		b.WriteString("<result>")
+		if e := s.deleteRecord(id); e == nil {
+			b.WriteString(element("id", id) + element("success", "true"))
+		} else {
+			b.WriteString(e.xml() + nilElement("id") + element("success", "false"))
+		}
+		b.WriteString("</result>")
+	}
+	b.WriteString("</deleteResponse>")
+	return b.String(), nil
+}
+
+// deleteRecord moves record to recycle bin
+func (s *Server) deleteRecord(id string) *saveError {
+	for _, obj := range s.objects {
+		for i, r := range obj.records {
+			if sameId(r["id"], id) {
+				obj.records = append(obj.records[:i], obj.records[i+1:]...)
+				r["isdeleted"] = "true"
+				obj.deleted = append(obj.deleted, r)
+				return nil
+			}
+		}
+	}
+	return newError("ENTITY_IS_DELETED", "entity is deleted")
+}
+
+// recycled removes record from recycle bin and returns it, nil is returned if record is not in recycle bin
+func (s *Server) recycled(id string) (*object, map[string]string) {
+	for _, obj := range s.objects {
+		for i, r := range obj.deleted {
+			if sameId(r["id"], id) {
+				obj.deleted = append(obj.deleted[:i], obj.deleted[i+1:]...)
+				return obj, r
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) undelete(request *node) (string, *soapError) {
+	return s.recycle("undelete", request, func(id string) *saveError {
+		obj, r := s.recycled(id)
+		if r == nil {
+			return newError("UNDELETE_FAILED", "Entity is not in the recycle bin")
+		}
+		delete(r, "isdeleted")
+		obj.records = append(obj.records, r)
+		return nil
+	})
+}
+
+func (s *Server) emptyRecycleBin(request *node) (string, *soapError) {
+	return s.recycle("emptyRecycleBin", request, func(id string) *saveError {
+		if _, r := s.recycled(id); r == nil {
+			return newError("INVALID_ID_FIELD", "Entity is not in the recycle bin")
+		}
+		return nil
+	})
+}
+
+// recycle applies operation to each of ids of the request
+func (s *Server) recycle(operation string, request *node, apply func(id string) *saveError) (string, *soapError) {
+	var b bytes.Buffer
+	b.WriteString("<" + operation + "Response>")
+	for _, n := range request.all("ids") {
+		id := strings.TrimSpace(n.Text)
+		b.WriteString("<result>")
+		if e := apply(id); e == nil {
+			b.WriteString(element("id", id) + element("success", "true"))
+		} else {
+			b.WriteString(e.xml() + nilElement("id") + element("success", "false"))
+		}
+		b.WriteString("</result>")
+	}
+	b.WriteString("</" + operation + "Response>")
+	return b.String(), nil
+}
+
+// merge merges records into master, references to merged records are moved to master
+func (s *Server) merge(request *node) (string, *soapError) {
+	var b bytes.Buffer
+	b.WriteString("<mergeResponse>")
+	for _, r := range request.all("request") {
+		b.WriteString("<result>")
+		id, merged, related, e := s.mergeRecords(r)
+		if e != nil {
+			b.WriteString(e.xml() + nilElement("id") + element("success", "false"))
+		} else {
+			b.WriteString(element("id", id))
+			for _, m := range merged {
+				b.WriteString(element("mergedRecordIds", m))
+			}
+			b.WriteString(element("success", "true"))
+			for _, u := range related {
+				b.WriteString(element("updatedRelatedIds", u))
+			}
+		}
+		b.WriteString("</result>")
+	}
+	b.WriteString("</mergeResponse>")
+	return b.String(), nil
+}
+
+func (s *Server) mergeRecords(request *node) (string, []string, []string, *saveError) {
+	master := request.child("masterRecord")
+	if master == nil {
+		return "", nil, nil, newError("MISSING_ARGUMENT", "masterRecord not specified")
+	}
+	obj, ok := s.objects[strings.ToLower(master.text("type"))]
+	if !ok || obj.find(master.text("Id")) == nil {
+		return "", nil, nil, newError("INVALID_CROSS_REFERENCE_KEY", "invalid cross reference id", "Id")
+	}
+	ids := request.all("recordToMergeIds")
+	if len(ids) == 0 || len(ids) > 2 {
+		return "", nil, nil, newError("INVALID_ARGUMENT", "one or two records to merge should be specified")
+	}
+	merged := make([]string, 0, len(ids))
+	for _, n := range ids {
+		r := obj.find(strings.TrimSpace(n.Text))
+		if r == nil || sameId(r["id"], master.text("Id")) {
+			return "", nil, nil, newError("INVALID_CROSS_REFERENCE_KEY", "invalid record to merge: "+n.Text)
+		}
+		merged = append(merged, r["id"])
+	}
+	id, _, e := s.saveRecord("update", "", master)
+	if e != nil {
+		return "", nil, nil, e
+	}
+	related := make([]string, 0)
+	for _, name := range s.names {
+		o := s.objects[strings.ToLower(name)]
+		for _, f := range o.Fields {
+			if f.Type != "reference" || !strings.EqualFold(f.ReferenceTo, obj.Name) {
+				continue
+			}
+			for _, r := range o.records {
+				for _, m := range merged {
+					if sameId(r[strings.ToLower(f.Name)], m) {
+						r[strings.ToLower(f.Name)] = id
+						related = append(related, r["id"])
+					}
+				}
+			}
+		}
+	}
+	for _, m := range merged {
+		s.deleteRecord(m)
+	}
+	return id, merged, related, nil
+}
+
+// convertLead converts leads into new or existing account and contact, and optionally into new opportunity.
+// Lead, Account and Contact objects should be defined, Opportunity is required only when it is created.
+func (s *Server) convertLead(request *node) (string, *soapError) {
+	var b bytes.Buffer
+	b.WriteString("<convertLeadResponse>")
+	for _, n := range request.all("leadConverts") {
+		b.WriteString("<result>")
+		ids, e := s.convert(n)
+		for _, name := range []string{"accountId", "contactId"} {
+			if ids[name] != "" {
+				b.WriteString(element(name, ids[name]))
+			} else {
+				b.WriteString(nilElement(name))
+			}
+		}
+		if e != nil {
+			b.WriteString(e.xml())
+		}
+		b.WriteString(element("leadId", n.text("leadId")))
+		if ids["opportunityId"] != "" {
+			b.WriteString(element("opportunityId", ids["opportunityId"]))
+		} else {
+			b.WriteString(nilElement("opportunityId"))
+		}
+		b.WriteString(element("success", fmt.Sprint(e == nil)))
+		b.WriteString("</result>")
+	}
+	b.WriteString("</convertLeadResponse>")
+	return b.String(), nil
+}
+
+func (s *Server) convert(request *node) (map[string]string, *saveError) {
+	ids := make(map[string]string)
+	leads, ok := s.objects["lead"]
+	if !ok {
+		return ids, newError("INVALID_TYPE", "sObject type 'Lead' is not supported.")
+	}
+	lead := leads.find(request.text("leadId"))
+	if lead == nil {
+		return ids, newError("INVALID_CROSS_REFERENCE_KEY", "invalid cross reference id", "leadId")
+	}
+	if lead["isconverted"] == "true" {
+		return ids, newError("CANNOT_UPDATE_CONVERTED_LEAD", "cannot reference converted lead")
+	}
+	status := request.text("convertedStatus")
+	if fd, ok := leads.field("Status"); status == "" || ok && len(fd.Picklist) > 0 && !contains(fd.Picklist, status) {
+		return ids, newError("INVALID_STATUS", "invalid convertedStatus: "+status, "convertedStatus")
+	}
+	accounts, contacts := s.objects["account"], s.objects["contact"]
+	if accounts == nil || contacts == nil {
+		return ids, newError("INVALID_TYPE", "sObject types 'Account' and 'Contact' should be supported.")
+	}
+	for _, f := range []struct{ name, sObject string }{{"accountId", "Account"}, {"contactId", "Contact"}, {"ownerId", "User"}} {
+		if id := request.text(f.name); id != "" {
+			if obj, ok := s.objects[strings.ToLower(f.sObject)]; ok && obj.find(id) == nil {
+				return ids, newError("INVALID_CROSS_REFERENCE_KEY", f.name+": id value of incorrect type: "+id, f.name)
+			}
+		}
+	}
+	var opportunities *object
+	if request.text("doNotCreateOpportunity") != "true" {
+		if opportunities, ok = s.objects["opportunity"]; !ok {
+			return ids, newError("INVALID_TYPE", "sObject type 'Opportunity' is not supported.")
+		}
+	}
+	owner := request.text("ownerId")
+	if owner == "" {
+		owner = lead["ownerid"]
+	}
+	// create records which are not specified in request
+	insert := func(obj *object, values map[string]string) string {
+		record := map[string]string{"id": s.newId(obj)}
+		for k, v := range values {
+			if _, ok := obj.field(k); ok && v != "" {
+				record[k] = v
+			}
+		}
+		obj.records = append(obj.records, record)
+		return record["id"]
+	}
+	name := lead["company"]
+	if name == "" {
+		name = lead["lastname"]
+	}
+	if ids["accountId"] = request.text("accountId"); ids["accountId"] == "" {
+		ids["accountId"] = insert(accounts, map[string]string{"name": name, "ownerid": owner})
+	}
+	if ids["contactId"] = request.text("contactId"); ids["contactId"] == "" {
+		ids["contactId"] = insert(contacts, map[string]string{
+			"firstname": lead["firstname"], "lastname": lead["lastname"], "email": lead["email"],
+			"accountid": ids["accountId"], "ownerid": owner,
+		})
+	}
+	if opportunities != nil {
+		if n := request.text("opportunityName"); n != "" {
+			name = n
+		}
+		ids["opportunityId"] = insert(opportunities, map[string]string{"name": name, "accountid": ids["accountId"], "ownerid": owner})
+	}
+	lead["status"] = status
+	lead["isconverted"] = "true"
+	for _, f := range []string{"accountId", "contactId", "opportunityId"} {
+		if _, ok := leads.field("Converted" + f); ok && ids[f] != "" {
+			lead[strings.ToLower("Converted"+f)] = ids[f]
+		}
+	}
+	return ids, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,352 @@
+package forcetest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testObjects() []*Object {
+	return []*Object{
+		&Object{
+			Name:   "Account",
+			Prefix: "001",
+			Fields: []*Field{
+				&Field{Name: "Name", Type: "string", Required: true},
+				&Field{Name: "ExtId__c", Type: "string", ExternalId: true},
+			},
+			Records: []map[string]string{
+				{"Name": "Acme", "ExtId__c": "A1"},
+				{"Name": "Globex", "ExtId__c": "A2"},
+				{"Name": "Initech", "ExtId__c": "A3"},
+			},
+		},
+		&Object{
+			Name:   "Contact",
+			Prefix: "003",
+			Fields: []*Field{
+				&Field{Name: "LastName", Type: "string", Required: true},
+				&Field{Name: "AccountId", Type: "reference", ReferenceTo: "Account", RelationshipName: "Account"},
+			},
+		},
+	}
+}
+
+func call(t *testing.T, server *Server, session bool, body string) (int, string) {
+	header := ""
+	if session {
+		header = `<SessionHeader><sessionId>` + SESSION_ID + `</sessionId></SessionHeader>`
+	}
+	envelope := `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="urn:partner.soap.sforce.com">` +
+		`<soapenv:Header>` + header + `</soapenv:Header><soapenv:Body>` + body + `</soapenv:Body></soapenv:Envelope>`
+	resp, err := http.Post(server.URL+"/services/Soap/u/42.0", "text/xml", strings.NewReader(envelope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func parse(t *testing.T, data string) *node {
+	var n node
+	if err := xml.Unmarshal([]byte(data), &n); err != nil {
+		t.Fatal(err)
+	}
+	return n.child("Body").Children[0]
+}
+
+func TestLogin(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	status, data := call(t, server, false, `<login><username>`+USERNAME+`</username><password>wrong</password></login>`)
+	if status != http.StatusInternalServerError || !strings.Contains(data, "INVALID_LOGIN") {
+		t.Fatal("expected login fault, got: ", data)
+	}
+	_, data = call(t, server, false, `<login><username>`+USERNAME+`</username><password>`+PASSWORD+`</password></login>`)
+	if id := parse(t, data).child("result").text("sessionId"); id != SESSION_ID {
+		t.Fatal("unexpected session id: ", id)
+	}
+	status, data = call(t, server, false, `<query><queryString>select Id from Account</queryString></query>`)
+	if status != http.StatusInternalServerError || !strings.Contains(data, "INVALID_SESSION_ID") {
+		t.Fatal("expected session fault, got: ", data)
+	}
+}
+
+func TestQueryMore(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	server.QueryBatchSize = 2
+	_, data := call(t, server, true, `<query><queryString>select Id, Name from Account where ExtId__c != 'A1'</queryString></query>`)
+	result := parse(t, data).child("result")
+	if result.text("done") != "true" || result.text("size") != "2" || len(result.all("records")) != 2 {
+		t.Fatal("unexpected result: ", data)
+	}
+	_, data = call(t, server, true, `<query><queryString>select Id, Name from Account</queryString></query>`)
+	result = parse(t, data).child("result")
+	if result.text("done") != "false" || len(result.all("records")) != 2 {
+		t.Fatal("unexpected first batch: ", data)
+	}
+	_, data = call(t, server, true, `<queryMore><queryLocator>`+result.text("queryLocator")+`</queryLocator></queryMore>`)
+	result = parse(t, data).child("result")
+	if result.text("done") != "true" || len(result.all("records")) != 1 || result.child("records").text("Name") != "Initech" {
+		t.Fatal("unexpected second batch: ", data)
+	}
+}
+
+func TestUpsertWithReference(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	_, data := call(t, server, true, `<upsert><externalIDFieldName>ExtId__c</externalIDFieldName>`+
+		`<sObjects><type>Account</type><ExtId__c>A1</ExtId__c><Name>Acme Corp</Name></sObjects>`+
+		`<sObjects><type>Account</type><ExtId__c>A9</ExtId__c><Name>Hooli</Name></sObjects>`+
+		`<sObjects><type>Account</type><ExtId__c>A8</ExtId__c></sObjects>`+
+		`</upsert>`)
+	results := parse(t, data).all("result")
+	if len(results) != 3 {
+		t.Fatal("unexpected results: ", data)
+	}
+	if results[0].text("success") != "true" || results[0].text("created") != "false" {
+		t.Fatal("expected update: ", data)
+	}
+	if results[1].text("success") != "true" || results[1].text("created") != "true" {
+		t.Fatal("expected insert: ", data)
+	}
+	if results[2].text("success") != "false" || results[2].child("errors").text("statusCode") != "REQUIRED_FIELD_MISSING" {
+		t.Fatal("expected error: ", data)
+	}
+	_, data = call(t, server, true, `<create><sObjects><type>Contact</type><LastName>Smith</LastName>`+
+		`<Account><type>Account</type><ExtId__c>A9</ExtId__c></Account></sObjects></create>`)
+	if result := parse(t, data).child("result"); result.text("success") != "true" {
+		t.Fatal("expected contact created: ", data)
+	}
+	_, data = call(t, server, true, `<query><queryString>select LastName, Account.Name from Contact</queryString></query>`)
+	record := parse(t, data).child("result").child("records")
+	if record.child("Account").text("Name") != "Hooli" {
+		t.Fatal("unexpected relationship value: ", data)
+	}
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	id := server.Records("Account")[0]["Id"]
+	_, data := call(t, server, true, `<update><sObjects><type>Account</type><Id>`+id+`</Id><fieldsToNull>ExtId__c</fieldsToNull></sObjects></update>`)
+	if result := parse(t, data).child("result"); result.text("success") != "true" {
+		t.Fatal("expected update: ", data)
+	}
+	if _, ok := server.Records("Account")[0]["ExtId__c"]; ok {
+		t.Fatal("expected field set to null")
+	}
+	_, data = call(t, server, true, `<delete><ids>`+id+`</ids><ids>001000000000099AAA</ids></delete>`)
+	results := parse(t, data).all("result")
+	if results[0].text("success") != "true" || results[1].text("success") != "false" {
+		t.Fatal("unexpected delete results: ", data)
+	}
+	if len(server.Records("Account")) != 2 || server.Calls("delete") != 1 {
+		t.Fatal("expected record deleted")
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := parseQuery("select Id, Name from Account where Name in ('a\\'b', 'c') and Type = null limit 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.sObject != "Account" || len(q.fields) != 2 || q.limit != 5 || len(q.conditions) != 2 {
+		t.Fatal("unexpected query: ", q)
+	}
+	if c := q.conditions[0]; c.field != "Name" || c.negate || len(c.values) != 2 || *c.values[0] != "a'b" {
+		t.Fatal("unexpected condition: ", c)
+	}
+	if c := q.conditions[1]; c.field != "Type" || len(c.values) != 1 || c.values[0] != nil {
+		t.Fatal("unexpected condition: ", c)
+	}
+}
+
+func restCall(t *testing.T, server *Server, method string, path string, body string, result interface{}) int {
+	req, err := http.NewRequest(method, server.URL+"/services/data/v46.0"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+SESSION_ID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestRest(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	server.QueryBatchSize = 2
+	var results []*restResult
+	restCall(t, server, "POST", "/composite/sobjects", `{"allOrNone":false,"records":[`+
+		`{"attributes":{"type":"Contact"},"LastName":"Smith","Account":{"attributes":{"type":"Account"},"ExtId__c":"A2"}},`+
+		`{"attributes":{"type":"Contact"},"LastName":null}]}`, &results)
+	if len(results) != 2 || !results[0].Success || results[0].Created != nil || results[1].Success || results[1].Errors[0].StatusCode != "REQUIRED_FIELD_MISSING" {
+		t.Fatal("unexpected results: ", results)
+	}
+	results = nil
+	restCall(t, server, "PATCH", "/composite/sobjects/Account/ExtId__c", `{"allOrNone":false,"records":[`+
+		`{"attributes":{"type":"Account"},"ExtId__c":"A1","Name":"Acme Corp"},`+
+		`{"attributes":{"type":"Account"},"ExtId__c":"A4","Name":"Hooli"}]}`, &results)
+	if len(results) != 2 || results[0].Created == nil || *results[0].Created || !*results[1].Created {
+		t.Fatal("unexpected results: ", results)
+	}
+	var query struct {
+		TotalSize      int                      `json:"totalSize"`
+		Done           bool                     `json:"done"`
+		NextRecordsUrl string                   `json:"nextRecordsUrl"`
+		Records        []map[string]interface{} `json:"records"`
+	}
+	restCall(t, server, "GET", "/query?q=select+Name+from+Account", "", &query)
+	if query.TotalSize != 4 || query.Done || len(query.Records) != 2 || query.Records[0]["Name"] != "Acme Corp" {
+		t.Fatal("unexpected query result: ", query)
+	}
+	restCall(t, server, "GET", strings.TrimPrefix(query.NextRecordsUrl, "/services/data/v46.0"), "", &query)
+	if !query.Done || len(query.Records) != 2 || query.Records[1]["Name"] != "Hooli" {
+		t.Fatal("unexpected query result: ", query)
+	}
+	restCall(t, server, "GET", "/query?q=select+LastName,+Account.Name+from+Contact", "", &query)
+	if account, ok := query.Records[0]["Account"].(map[string]interface{}); !ok || account["Name"] != "Globex" {
+		t.Fatal("unexpected query result: ", query)
+	}
+	results = nil
+	id := server.Records("Contact")[0]["Id"]
+	restCall(t, server, "DELETE", "/composite/sobjects?ids="+id, "", &results)
+	if len(results) != 1 || !results[0].Success || len(server.Records("Contact")) != 0 {
+		t.Fatal("unexpected results: ", results)
+	}
+	if server.Calls("GET query") != 3 {
+		t.Fatal("unexpected number of calls: ", server.Calls("GET query"))
+	}
+}
+
+func TestTree(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	var result treeResult
+	status := restCall(t, server, "POST", "/composite/tree/Account", `{"records":[`+
+		`{"attributes":{"type":"Account","referenceId":"p1"},"Name":"Hooli","Contacts":{"records":[`+
+		`{"attributes":{"type":"Contact","referenceId":"c2"},"LastName":"Smith"}]}}]}`, &result)
+	if status != http.StatusCreated || result.HasErrors || len(result.Results) != 2 || result.Results[1].ReferenceId != "c2" {
+		t.Fatal("unexpected result: ", status, result)
+	}
+	contacts := server.Records("Contact")
+	if len(contacts) != 1 || contacts[0]["AccountId"] != result.Results[0].Id {
+		t.Fatal("expected contact of the new account: ", contacts)
+	}
+	// nothing is saved when a record fails
+	result = treeResult{}
+	status = restCall(t, server, "POST", "/composite/tree/Account", `{"records":[`+
+		`{"attributes":{"type":"Account","referenceId":"p3"},"Name":"Vandelay","Contacts":{"records":[`+
+		`{"attributes":{"type":"Contact","referenceId":"c4"},"LastName":null}]}}]}`, &result)
+	if status != http.StatusBadRequest || !result.HasErrors || len(result.Results) != 1 || result.Results[0].ReferenceId != "c4" {
+		t.Fatal("unexpected result: ", status, result)
+	}
+	if len(server.Records("Account")) != 4 || len(server.Records("Contact")) != 1 {
+		t.Fatal("expected failed tree rolled back")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	accounts := server.Records("Account")
+	call(t, server, true, `<create><sObjects><type>Contact</type><LastName>Smith</LastName><AccountId>`+accounts[1]["Id"]+`</AccountId></sObjects></create>`)
+	_, data := call(t, server, true, `<merge><request><masterRecord><type>Account</type><Id>`+accounts[0]["Id"]+`</Id><Name>Acme Corp</Name></masterRecord>`+
+		`<recordToMergeIds>`+accounts[1]["Id"]+`</recordToMergeIds><recordToMergeIds>`+accounts[2]["Id"]+`</recordToMergeIds></request></merge>`)
+	result := parse(t, data).child("result")
+	if result.text("success") != "true" || len(result.all("mergedRecordIds")) != 2 || len(result.all("updatedRelatedIds")) != 1 {
+		t.Fatal("unexpected merge result: ", data)
+	}
+	accounts = server.Records("Account")
+	if len(accounts) != 1 || accounts[0]["Name"] != "Acme Corp" || server.Records("Contact")[0]["AccountId"] != accounts[0]["Id"] {
+		t.Fatal("unexpected records after merge: ", accounts)
+	}
+}
+
+func TestConvertLead(t *testing.T) {
+	objects := append(testObjects(), &Object{
+		Name:   "Lead",
+		Prefix: "00Q",
+		Fields: []*Field{
+			&Field{Name: "LastName", Type: "string", Required: true},
+			&Field{Name: "Company", Type: "string"},
+			&Field{Name: "Status", Type: "picklist", Picklist: []string{"Open", "Converted"}},
+			&Field{Name: "IsConverted", Type: "boolean", ReadOnly: true},
+			&Field{Name: "ConvertedAccountId", Type: "reference", ReferenceTo: "Account", ReadOnly: true},
+			&Field{Name: "ConvertedContactId", Type: "reference", ReferenceTo: "Contact", ReadOnly: true},
+		},
+		Records: []map[string]string{{"LastName": "Smith", "Company": "Hooli", "Status": "Open"}},
+	})
+	server := NewServer(objects...)
+	defer server.Close()
+	lead := server.Records("Lead")[0]["Id"]
+	_, data := call(t, server, true, `<convertLead><leadConverts><convertedStatus>Converted</convertedStatus>`+
+		`<doNotCreateOpportunity>false</doNotCreateOpportunity><leadId>`+lead+`</leadId></leadConverts></convertLead>`)
+	if result := parse(t, data).child("result"); result.text("success") != "false" {
+		t.Fatal("expected error of missing opportunity object: ", data)
+	}
+	_, data = call(t, server, true, `<convertLead><leadConverts><convertedStatus>Converted</convertedStatus>`+
+		`<doNotCreateOpportunity>true</doNotCreateOpportunity><leadId>`+lead+`</leadId></leadConverts></convertLead>`)
+	result := parse(t, data).child("result")
+	if result.text("success") != "true" || result.text("contactId") == "" || result.text("opportunityId") != "" {
+		t.Fatal("unexpected convert result: ", data)
+	}
+	accounts := server.Records("Account")
+	if len(accounts) != 4 || accounts[3]["Name"] != "Hooli" || accounts[3]["Id"] != result.text("accountId") {
+		t.Fatal("expected account created: ", accounts)
+	}
+	if converted := server.Records("Lead")[0]; converted["IsConverted"] != "true" || converted["ConvertedContactId"] != result.text("contactId") {
+		t.Fatal("expected lead converted: ", converted)
+	}
+	_, data = call(t, server, true, `<convertLead><leadConverts><convertedStatus>Converted</convertedStatus>`+
+		`<doNotCreateOpportunity>true</doNotCreateOpportunity><leadId>`+lead+`</leadId></leadConverts></convertLead>`)
+	if result := parse(t, data).child("result"); result.child("errors").text("statusCode") != "CANNOT_UPDATE_CONVERTED_LEAD" {
+		t.Fatal("expected error of converted lead: ", data)
+	}
+}
+
+func TestRecycleBin(t *testing.T) {
+	server := NewServer(testObjects()...)
+	defer server.Close()
+	accounts := server.Records("Account")
+	call(t, server, true, `<delete><ids>`+accounts[0]["Id"]+`</ids><ids>`+accounts[1]["Id"]+`</ids></delete>`)
+	_, data := call(t, server, true, `<queryAll><queryString>select Id, Name from Account</queryString></queryAll>`)
+	if result := parse(t, data).child("result"); len(result.all("records")) != 3 {
+		t.Fatal("expected deleted records queried: ", data)
+	}
+	_, data = call(t, server, true, `<undelete><ids>`+accounts[0]["Id"]+`</ids><ids>`+accounts[2]["Id"]+`</ids></undelete>`)
+	results := parse(t, data).all("result")
+	if results[0].text("success") != "true" || results[1].child("errors").text("statusCode") != "UNDELETE_FAILED" {
+		t.Fatal("unexpected undelete results: ", data)
+	}
+	_, data = call(t, server, true, `<emptyRecycleBin><ids>`+accounts[1]["Id"]+`</ids></emptyRecycleBin>`)
+	if result := parse(t, data).child("result"); result.text("success") != "true" {
+		t.Fatal("unexpected empty recycle bin result: ", data)
+	}
+	if len(server.Records("Account")) != 2 || len(server.Deleted("Account")) != 0 {
+		t.Fatal("unexpected records: ", server.Records("Account"), server.Deleted("Account"))
+	}
+	var query struct {
+		Records []map[string]interface{} `json:"records"`
+	}
+	call(t, server, true, `<delete><ids>`+accounts[2]["Id"]+`</ids></delete>`)
+	restCall(t, server, "GET", "/queryAll?q=select+Name+from+Account", "", &query)
+	if len(query.Records) != 2 || len(server.Records("Account")) != 1 {
+		t.Fatal("expected deleted records queried: ", query)
+	}
+}
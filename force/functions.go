@@ -33,22 +33,47 @@ func (target *SalesforceTarget) NewFunctionsSupplier() eval.Functions {
 			}
 			lookupName := fmt.Sprint(args[0], "/", strings.Join(fields, "/"))
 			// was lookup created?
+			target.lookupsLock.Lock()
 			scan, ok := target.lookups[lookupName]
 			if !ok {
 				// create lookup and read it
 				source := &SalesforceSource{instance: target.instance, Query: args[0].(string)}
 				scan, err = source.NewScan(&commons.Lookup{Keys: fields})
 				if err != nil {
+					target.lookupsLock.Unlock()
 					panic(errors.New(fmt.Sprint("error creating lookup: ", err.Error())))
 				}
 				target.lookups[lookupName] = scan
 			}
+			target.lookupsLock.Unlock()
 			var keys = make([]interface{}, np)
 			for i := 0; i < np; i++ {
 				keys[i] = args[i*2+2]
 			}
 			val, err = scan(keys, s1, args[len(args)-1])
 			return val, err
+		case "RECORDTYPE":
+			eval.NumOfParams(args, 2)
+			if args[1] == nil || args[1] == "" {
+				return nil, nil
+			}
+			return target.instance.recordTypeId(eval.MustBeString(args, 0), eval.MustBeString(args, 1))
+		case "USER":
+			eval.NumOfParams(args, 1)
+			if args[0] == nil || args[0] == "" {
+				return nil, nil
+			}
+			name := eval.MustBeString(args, 0)
+			if mapped, ok := target.UserMapping[strings.ToLower(name)]; ok {
+				name = mapped
+			}
+			return target.instance.userId(name)
+		case "QUEUE":
+			eval.NumOfParams(args, 1)
+			if args[0] == nil || args[0] == "" {
+				return nil, nil
+			}
+			return target.instance.queueId(eval.MustBeString(args, 0))
 		}
 		return nil, eval.NOFUNC{}
 	}
@@ -0,0 +1,248 @@
+package force
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Graph defines root object and related objects exported to csv files with references replaced by portable keys.
+// Files could be imported into another instance by upserting objects in the order of their references.
+type Graph struct {
+	Instance string         `json:"instance"`
+	Target   string         `json:"target"`
+	Path     string         `json:"path"`
+	Root     *GraphObject   `json:"root"`
+	Related  []*GraphObject `json:"related"`
+	instance *Instance
+	target   *Instance
+}
+
+// GraphObject is an object of the graph. Key is external id field used to match and to reference records in target
+// instance. If KeyFromId is set key values are taken from Id of the source records, otherwise from key field itself.
+type GraphObject struct {
+	SObject   string   `json:"sObject"`
+	Key       string   `json:"key"`
+	KeyFromId bool     `json:"keyFromId"`
+	Fields    []string `json:"fields"`
+	Where     string   `json:"where"`
+}
+
+// GraphImport is one object of the graph to be loaded from csv file
+type GraphImport struct {
+	Instance string
+	SObject  string
+	Key      string
+	Path     string
+}
+
+func (g *Graph) Init(resolver func(string) string) (err error) {
+	if g == nil {
+		return
+	}
+	g.Instance = resolver(g.Instance)
+	g.Target = resolver(g.Target)
+	g.Path = resolver(g.Path)
+	if g.Root == nil {
+		return errors.New(fmt.Sprint("root object should be specified"))
+	}
+	for _, o := range g.objects() {
+		if o.SObject == "" || o.Key == "" {
+			return errors.New(fmt.Sprint("sObject and key should be specified for each object"))
+		}
+	}
+	if g.Instance != "" {
+		if g.instance, err = resolveInstance(g.Instance); err != nil {
+			return err
+		}
+	}
+	if g.Target != "" {
+		g.target, err = resolveInstance(g.Target)
+	}
+	return
+}
+
+func (g *Graph) objects() []*GraphObject {
+	return append([]*GraphObject{g.Root}, g.Related...)
+}
+
+func (g *Graph) path(sObject string) string {
+	return filepath.Join(g.Path, sObject+".csv")
+}
+
+// Export reads root records and related records and writes one csv file per object.
+func (g *Graph) Export() error {
+	if g.instance == nil {
+		return errors.New("instance to export from should be specified")
+	}
+	if err := g.instance.connect(); err != nil {
+		return err
+	}
+	sample := &Sample{instance: g.instance, Root: SampleRoot{SObject: g.Root.SObject, Where: g.Root.Where}}
+	objects := make([]*sampled, 0, len(g.Related)+1)
+	root, err := sample.readRoot()
+	if err != nil {
+		return err
+	}
+	objects = append(objects, root)
+	for _, r := range g.Related {
+		o, err := sample.readRelated(&SampleObject{SObject: r.SObject, Fields: r.Fields, Where: r.Where}, objects)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, o)
+	}
+	// keys of all exported records by id
+	defs := g.objects()
+	keys := make(map[string]map[string]string)
+	for i, o := range objects {
+		k := make(map[string]string)
+		for _, record := range o.records {
+			id := String(o.get(record, "Id"))
+			if defs[i].KeyFromId {
+				k[shortId(id)] = id
+			} else {
+				k[shortId(id)] = String(o.get(record, defs[i].Key))
+			}
+		}
+		keys[strings.ToLower(o.describe.Name)] = k
+	}
+	for i, o := range objects {
+		if err := g.writeObject(o, defs[i], keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCsvHeader returns column names of csv file, it is used to find fields present in exported files.
+func ReadCsvHeader(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("cannot open file: ", path))
+	}
+	defer file.Close()
+	header, err := csv.NewReader(file).Read()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("cannot read header of file: ", path, " : ", err))
+	}
+	return header, nil
+}
+
+func (g *Graph) writeObject(o *sampled, def *GraphObject, keys map[string]map[string]string) error {
+	type column struct {
+		name   string
+		field  string
+		parent string
+	}
+	columns := []column{{name: def.Key, field: def.Key}}
+	for _, f := range o.fields {
+		fd := o.describe.Get(f)
+		if fd == nil || !fd.Createable || strings.EqualFold(fd.Name, def.Key) {
+			continue
+		}
+		if fd.Type != "reference" {
+			columns = append(columns, column{name: fd.Name, field: fd.Name})
+			continue
+		}
+		// references are replaced with keys of exported records, references to other objects are not portable
+		parent := ""
+		for _, to := range fd.ReferenceTo {
+			if _, ok := keys[strings.ToLower(to)]; ok {
+				parent = to
+				break
+			}
+		}
+		if parent == "" || fd.RelationshipName == "" {
+			log.Println(commons.PROGRESS, "not exported reference: ", o.describe.Name, ".", fd.Name)
+			continue
+		}
+		parentKey := ""
+		for _, d := range g.objects() {
+			if strings.EqualFold(d.SObject, parent) {
+				parentKey = d.Key
+			}
+		}
+		columns = append(columns, column{
+			name:   fd.RelationshipName + ":" + parent + "." + parentKey,
+			field:  fd.Name,
+			parent: strings.ToLower(parent),
+		})
+	}
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	rows := make([][]string, 0, len(o.records))
+	for _, record := range o.records {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			if i == 0 {
+				row[i] = keys[strings.ToLower(o.describe.Name)][shortId(String(o.get(record, "Id")))]
+			} else if v := o.get(record, c.field); v != nil {
+				if c.parent != "" {
+					row[i] = keys[c.parent][shortId(String(v))]
+				} else {
+					row[i] = String(v)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return writeCsvFile(g.path(def.SObject), header, rows)
+}
+
+// ImportPlan returns objects of the graph in the order they should be loaded, parents before children. Only references
+// loaded from columns of exported files are taken into account.
+func (g *Graph) ImportPlan() ([]*GraphImport, error) {
+	if g.target == nil {
+		return nil, errors.New("target instance to import into should be specified")
+	}
+	if err := g.target.connect(); err != nil {
+		return nil, err
+	}
+	defs := make(map[string]*GraphObject)
+	names := make([]string, 0)
+	for _, o := range g.objects() {
+		defs[strings.ToLower(o.SObject)] = o
+		names = append(names, strings.ToLower(o.SObject))
+	}
+	dependsOn := make(map[string][]string)
+	for _, name := range names {
+		describe, err := g.target.connection.DescribeSObject(defs[name].SObject)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("error describing SObject: ", defs[name].SObject, "\n", err))
+		}
+		header, err := ReadCsvHeader(g.path(defs[name].SObject))
+		if err != nil {
+			return nil, err
+		}
+		references, err := fieldReferences(describe, header)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("error in file ", g.path(defs[name].SObject), ": ", err))
+		}
+		for _, objects := range references {
+			for _, to := range objects {
+				if _, ok := defs[strings.ToLower(to)]; ok {
+					dependsOn[name] = append(dependsOn[name], strings.ToLower(to))
+				}
+			}
+		}
+	}
+	ordered, cyclic := commons.TopologicalOrder(names, dependsOn)
+	if len(cyclic) > 0 {
+		return nil, errors.New(fmt.Sprint("circular references between objects: ", strings.Join(cyclic, ", ")))
+	}
+	plan := make([]*GraphImport, 0, len(ordered))
+	for _, name := range ordered {
+		o := defs[name]
+		plan = append(plan, &GraphImport{Instance: g.Target, SObject: o.SObject, Key: o.Key, Path: g.path(o.SObject)})
+	}
+	return plan, nil
+}
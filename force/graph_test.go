@@ -0,0 +1,38 @@
+package force
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGraphImportPlan(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	path := t.TempDir()
+	files := map[string]string{
+		"Contact.csv": "Email,LastName,Account:Account.ExtId__c\n",
+		// converted account is not loaded, so lead does not depend on account
+		"Lead.csv":    "LastName,Company\n",
+		"Account.csv": "ExtId__c,Name\n",
+	}
+	for name, header := range files {
+		if err := ioutil.WriteFile(filepath.Join(path, name), []byte(header), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	graph := &Graph{Target: "test", Path: path, Root: &GraphObject{SObject: "Contact", Key: "Email"}, Related: []*GraphObject{
+		&GraphObject{SObject: "Lead", Key: "LastName"},
+		&GraphObject{SObject: "Account", Key: "ExtId__c"},
+	}}
+	if err := graph.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := graph.ImportPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 3 || plan[0].SObject != "Lead" || plan[1].SObject != "Account" || plan[2].SObject != "Contact" {
+		t.Fatal("unexpected plan: ", plan)
+	}
+}
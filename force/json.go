@@ -0,0 +1,89 @@
+package force
+
+import (
+	"encoding/json"
+	. "github.com/goforce/api/commons"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonRecord converts record to the map sent to rest api. Nested fields like Account:Account.ExtId__c or
+// Account.ExtId__c and nested records are converted to nested maps referencing records by external id.
+func jsonRecord(describe *DescribeSObjectResult, record Record) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, f := range record.Fields() {
+		value, _ := record.Get(f)
+		parts := strings.SplitN(f, ".", 2)
+		if len(parts) == 2 {
+			ts := strings.Split(parts[0], ":")
+			nested, ok := m[ts[0]].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				m[ts[0]] = nested
+			}
+			if len(ts) > 1 {
+				nested["attributes"] = map[string]interface{}{"type": ts[1]}
+			}
+			nested[parts[1]] = jsonValue(nil, value)
+			continue
+		}
+		if r, ok := value.(Record); ok {
+			if len(r.Fields()) > 0 {
+				m[f] = jsonRecord(nil, r)
+			}
+			continue
+		}
+		var fd *FieldDescribe
+		if describe != nil {
+			fd = describe.Get(f)
+		}
+		m[f] = jsonValue(fd, value)
+	}
+	return m
+}
+
+// jsonValue converts value to the type expected by rest api for the field.
+func jsonValue(fd *FieldDescribe, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch value.(type) {
+	case bool:
+		return value
+	case time.Time:
+		if fd != nil && fd.Type == "date" {
+			return value.(time.Time).Format("2006-01-02")
+		}
+		return value.(time.Time).UTC().Format("2006-01-02T15:04:05.000Z")
+	case *big.Rat:
+		return json.Number(decimalString(value.(*big.Rat)))
+	}
+	s := String(value)
+	if fd == nil {
+		return s
+	}
+	switch fd.Type {
+	case "int", "double", "currency", "percent":
+		if strings.TrimSpace(s) == "" {
+			return nil
+		}
+		if r, ok := new(big.Rat).SetString(strings.TrimSpace(s)); ok {
+			return json.Number(decimalString(r))
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+func decimalString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := strings.TrimRight(r.FloatString(18), "0")
+	return strings.TrimSuffix(s, ".")
+}
@@ -1,7 +1,6 @@
 package force
 
 import (
-	. "github.com/goforce/api/commons"
 	"github.com/goforce/reloader/commons"
 )
 
@@ -9,7 +8,7 @@ func (source *SalesforceSource) NewScan(lookup *commons.Lookup) (commons.Scan, e
 	if err := source.instance.connect(); err != nil {
 		return nil, err
 	}
-	records, err := ReadAll(source.instance.connection.Query(source.Query))
+	records, err := readAll(source.instance.connection.Query(source.Query))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,33 @@
+package force
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT"}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	functions := target.NewFunctionsSupplier()
+	query := "select Id, ExtId__c from Account"
+	v, err := functions("LOOKUP", []interface{}{query, "ExtId__c", "A2", "Id", nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != findRecord(server.Records("Account"), "ExtId__c", "A2")["Id"] {
+		t.Fatal("unexpected lookup value: ", v)
+	}
+	v, err = functions("LOOKUP", []interface{}{query, "ExtId__c", "A9", "Id", "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "none" {
+		t.Fatal("expected default value, got: ", v)
+	}
+	if server.Calls("query") != 1 {
+		t.Fatal("expected lookup to be read once")
+	}
+}
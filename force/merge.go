@@ -0,0 +1,127 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"strings"
+)
+
+const (
+	// target fields naming records merged into the master record, master is named by Id
+	MERGE_ID_1 string = "MergeId1"
+	MERGE_ID_2 string = "MergeId2"
+)
+
+var mergeableObjects = []string{"Account", "Contact", "Lead"}
+
+// mergeRecord is a record of master with ids of records to be merged into it
+type mergeRecord struct {
+	Record
+	ids [2]string
+}
+
+func mergeIndex(name string) int {
+	if strings.EqualFold(name, MERGE_ID_1) {
+		return 0
+	} else if strings.EqualFold(name, MERGE_ID_2) {
+		return 1
+	}
+	return -1
+}
+
+func (r *mergeRecord) Get(name string) (interface{}, bool) {
+	if i := mergeIndex(name); i >= 0 {
+		if r.ids[i] == "" {
+			return nil, true
+		}
+		return r.ids[i], true
+	}
+	return r.Record.Get(name)
+}
+
+func (r *mergeRecord) Set(name string, value interface{}) (interface{}, error) {
+	if i := mergeIndex(name); i >= 0 {
+		if value == nil {
+			r.ids[i] = ""
+		} else {
+			r.ids[i] = strings.TrimSpace(String(value))
+		}
+		return value, nil
+	}
+	return r.Record.Set(name, value)
+}
+
+func (r *mergeRecord) Fields() []string {
+	fields := r.Record.Fields()
+	if r.ids[0] != "" {
+		fields = append(fields, MERGE_ID_1)
+	}
+	if r.ids[1] != "" {
+		fields = append(fields, MERGE_ID_2)
+	}
+	return fields
+}
+
+// mergeIds returns ids of records to be merged, master Id and at least one id to merge are required.
+func (r *mergeRecord) mergeIds() ([]string, error) {
+	if id, _ := r.Record.Get("Id"); id == nil || String(id) == "" {
+		return nil, errors.New("Id of master record should be specified")
+	}
+	ids := make([]string, 0, 2)
+	for _, id := range r.ids {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New(fmt.Sprint("at least one of ", MERGE_ID_1, " or ", MERGE_ID_2, " should be specified"))
+	}
+	return ids, nil
+}
+
+// merge merges records using soap api, each record is a master with values to be set and ids of records merged into it.
+func (writer *ForceWriter) merge(records []Record) ([]DmlResult, error) {
+	s, err := writer.instance.restSession()
+	if err != nil {
+		return nil, err
+	}
+	var body strings.Builder
+	body.WriteString("<urn:merge>")
+	for _, record := range records {
+		mr := record.(*mergeRecord)
+		ids, _ := mr.mergeIds()
+		body.WriteString("<urn:request><urn:masterRecord>")
+		body.WriteString("<urn1:type>" + writer.sObjectDescribe.Name + "</urn1:type>")
+		body.WriteString(soapRecord(writer.sObjectDescribe, writer.nestedFields, mr.Record))
+		body.WriteString("</urn:masterRecord>")
+		for _, id := range ids {
+			body.WriteString("<urn:recordToMergeIds>" + escapeXml(id) + "</urn:recordToMergeIds>")
+		}
+		body.WriteString("</urn:request>")
+	}
+	body.WriteString("</urn:merge>")
+	var response struct {
+		Results []struct {
+			Success           bool        `xml:"success"`
+			Id                string      `xml:"id"`
+			MergedRecordIds   []string    `xml:"mergedRecordIds"`
+			UpdatedRelatedIds []string    `xml:"updatedRelatedIds"`
+			Errors            []soapError `xml:"errors"`
+		} `xml:"mergeResponse>result"`
+	}
+	if err := s.soap("merge", body.String(), &response); err != nil {
+		return nil, err
+	}
+	results := make([]DmlResult, len(response.Results))
+	for i, r := range response.Results {
+		results[i] = DmlResult{Success: r.Success, Id: r.Id, Message: soapMessage(r.Errors)}
+		if r.Success {
+			results[i].Details = []string{
+				fmt.Sprint("merged and deleted=", strings.Join(r.MergedRecordIds, ",")),
+				fmt.Sprint("related records updated=", len(r.UpdatedRelatedIds)),
+			}
+		}
+	}
+	return results, nil
+}
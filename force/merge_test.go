@@ -0,0 +1,37 @@
+package force
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	accounts := server.Records("Account")
+	writeContacts(t, "INSERT", []map[string]interface{}{{"LastName": "Smith", "Account:Account.ExtId__c": "A2"}})
+	target := &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "MERGE"}
+	reports := write(t, target, []string{"Id", "Name", MERGE_ID_1, MERGE_ID_2}, []map[string]interface{}{
+		{"Id": accounts[0]["Id"], "Name": "Acme Corp", MERGE_ID_1: accounts[1]["Id"], MERGE_ID_2: accounts[2]["Id"]},
+		{"Id": accounts[0]["Id"], "Name": "Acme"},
+	})
+	if !reports[0].success || reports[0].id != accounts[0]["Id"] {
+		t.Fatal("expected records merged: ", reports[0].err)
+	}
+	if len(reports[0].details) != 2 || !strings.Contains(reports[0].details[0], accounts[1]["Id"]) {
+		t.Fatal("unexpected details: ", reports[0].details)
+	}
+	if reports[1].success || !strings.Contains(reports[1].err, MERGE_ID_1) {
+		t.Fatal("expected error of missing records to merge: ", reports[1].err)
+	}
+	if len(server.Records("Account")) != 1 || server.Records("Contact")[0]["AccountId"] != accounts[0]["Id"] {
+		t.Fatal("unexpected records after merge")
+	}
+}
+
+func TestMergeObjects(t *testing.T) {
+	target := &SalesforceTarget{Instance: "test", SObject: "Opportunity", Operation: "MERGE"}
+	if err := target.Init(noresolve); err == nil {
+		t.Fatal("expected error of object not supported by merge")
+	}
+}
@@ -0,0 +1,97 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/reloader/commons"
+	"strings"
+)
+
+// operations which are given only ids of records, their fields are not checked
+var idOperations = []string{"DELETE", "HARDDELETE", "UNDELETE", "EMPTYRECYCLEBIN", "CONVERTLEAD"}
+
+// Precheck implements commons.Prechecker. Every target field is checked against describe of the target sObject:
+// fields should be createable for INSERT, updateable for UPDATE and both for UPSERT, fields referencing records
+// should use external ids and externalId of UPSERT should be an idLookup field.
+func (writer *ForceWriter) Precheck() error {
+	describe := writer.sObjectDescribe
+	if describe == nil || commons.ContainsFold(idOperations, writer.operation) {
+		return nil
+	}
+	insertOnly := make(map[string]bool)
+	for _, f := range writer.insertOnlyFields() {
+		insertOnly[strings.ToLower(f)] = true
+	}
+	deferred := make(map[string]bool)
+	if writer.deferred != nil {
+		for _, f := range topLevelFields(writer.deferred.fields) {
+			deferred[strings.ToLower(f)] = true
+		}
+	}
+	problems := make([]string, 0)
+	checked := make(map[string]bool)
+	for _, f := range writer.fields {
+		if mergeIndex(f) >= 0 {
+			continue
+		}
+		var fd *FieldDescribe
+		name := topLevelFields([]string{f})[0]
+		if parts := strings.SplitN(f, ".", 2); len(parts) == 2 {
+			fd = describe.GetRelationship(name)
+			if nested := writer.nestedFields[name]; nested != nil {
+				if nfd := nested.Get(parts[1]); nfd == nil {
+					problems = append(problems, fmt.Sprint(f, ": no such field in ", nested.Name))
+				} else if !nfd.IdLookup && !nfd.ExternalId {
+					problems = append(problems, fmt.Sprint(f, ": ", nested.Name, ".", nfd.Name, " is not an external id and can not reference records"))
+				}
+			}
+		} else {
+			fd = describe.Get(name)
+		}
+		if fd == nil {
+			problems = append(problems, fmt.Sprint(f, ": no such field in ", describe.Name))
+			continue
+		}
+		if checked[strings.ToLower(fd.Name)] {
+			continue
+		}
+		checked[strings.ToLower(fd.Name)] = true
+		if strings.EqualFold(fd.Name, "Id") {
+			if writer.operation == "INSERT" || writer.operation == "PUBLISH" {
+				problems = append(problems, fmt.Sprint(f, ": Id can not be set by ", writer.operation))
+			}
+			continue
+		}
+		create := writer.operation == "INSERT" || writer.operation == "PUBLISH" || writer.operation == "UPSERT"
+		update := writer.operation == "UPDATE" || writer.operation == "UPSERT" || writer.operation == "MERGE"
+		if insertOnly[strings.ToLower(name)] {
+			update = false
+		}
+		// deferred fields are set by update of the second pass
+		if deferred[strings.ToLower(name)] {
+			create, update = false, true
+		}
+		kind := "field"
+		if fd.Calculated {
+			kind = "formula field"
+		}
+		if create && !fd.Createable {
+			problems = append(problems, fmt.Sprint(f, ": ", kind, " is not createable"))
+		}
+		if update && !fd.Updateable {
+			problems = append(problems, fmt.Sprint(f, ": ", kind, " is not updateable"))
+		}
+	}
+	if writer.operation == "UPSERT" {
+		if fd := describe.Get(writer.externalId); fd == nil {
+			problems = append(problems, fmt.Sprint("externalId ", writer.externalId, ": no such field in ", describe.Name))
+		} else if !fd.IdLookup {
+			problems = append(problems, fmt.Sprint("externalId ", writer.externalId, ": field is not an external id or idLookup field"))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprint(len(problems), " problems with target fields of ", writer.operation, " of ", describe.Name, ":\n", strings.Join(problems, "\n")))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package force
+
+import (
+	"github.com/goforce/reloader/commons"
+	"strings"
+	"testing"
+)
+
+func precheck(t *testing.T, target *SalesforceTarget, fields []string, flags commons.Flags) error {
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	writer.(commons.UsesFlags).SetFlags(flags)
+	return writer.(commons.Prechecker).Precheck()
+}
+
+func TestPrecheck(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "UPSERT", ExternalId: "Email"}
+	err := precheck(t, target, []string{"Id", "LastName", "Greeting__c", "Account:Account.Name", "Account.ExtId__c"}, nil)
+	if err == nil {
+		t.Fatal("expected precheck errors")
+	}
+	for _, problem := range []string{
+		"Greeting__c: formula field is not createable",
+		"Greeting__c: formula field is not updateable",
+		"Account:Account.Name: Account.Name is not an external id",
+		"externalId Email: field is not an external id",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Fatal("expected problem: ", problem, " in: ", err)
+		}
+	}
+	if strings.Contains(err.Error(), "LastName") || strings.Contains(err.Error(), "Account.ExtId__c:") {
+		t.Fatal("unexpected problems: ", err)
+	}
+	if !strings.HasPrefix(err.Error(), "4 problems") {
+		t.Fatal("expected all problems listed: ", err)
+	}
+}
+
+func TestPrecheckFlags(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	// converted account id is read only, it is reported for insert, but not for update when it is insert only
+	target := &SalesforceTarget{Instance: "test", SObject: "Lead", Operation: "INSERT"}
+	if err := precheck(t, target, []string{"Id", "LastName", "ConvertedAccountId"}, nil); err == nil ||
+		!strings.Contains(err.Error(), "Id: Id can not be set") || !strings.Contains(err.Error(), "ConvertedAccountId: field is not createable") {
+		t.Fatal("expected precheck errors: ", err)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Lead", Operation: "UPDATE"}
+	flags := commons.Flags{"ConvertedAccountId": {commons.FLAG_INSERT_ONLY: true}}
+	if err := precheck(t, target, []string{"Id", "LastName", "ConvertedAccountId"}, flags); err != nil {
+		t.Fatal(err)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Lead", Operation: "DELETE"}
+	if err := precheck(t, target, []string{"Id"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,7 +2,7 @@ package force
 
 import (
 	"fmt"
-	. "github.com/goforce/api/commons"
+	"github.com/goforce/eval"
 	"github.com/goforce/log"
 	"github.com/goforce/reloader/commons"
 	"github.com/goforce/reloader/force/soqlparser"
@@ -10,9 +10,11 @@ import (
 )
 
 type ForceReader struct {
-	*QueryReader
-	id     string
-	fields []string
+	QueryCursor
+	id          string
+	fields      []string
+	exportFiles eval.Expr
+	binaryField string
 }
 
 func (s *SalesforceSource) NewReader() (commons.Reader, error) {
@@ -38,11 +40,18 @@ func (s *SalesforceSource) NewReader() (commons.Reader, error) {
 	} else {
 		log.Println(commons.PROGRESS, "querying solq: ", s.Query)
 	}
-	reader, err := NewReader(s.instance.connection.Query(s.Query))
+	query := s.instance.connection.Query
+	if s.QueryAll {
+		query = s.instance.connection.QueryAll
+	}
+	reader, err := query(s.Query)
 	if err != nil {
 		return nil, err
 	}
-	return &ForceReader{reader, "", soqlparser.SoqlFields(s.Query)}, nil
+	if s.exportFiles != nil {
+		log.Println(commons.PROGRESS, "exporting ", s.binaryField, " to files: ", s.ExportFiles)
+	}
+	return &ForceReader{reader, "", soqlparser.SoqlFields(s.Query), s.exportFiles, s.binaryField}, nil
 }
 
 func (reader *ForceReader) Fields() []string {
@@ -50,8 +59,13 @@ func (reader *ForceReader) Fields() []string {
 }
 
 func (reader *ForceReader) Read() (commons.Record, error) {
-	if record, err := reader.QueryReader.Read(); err == nil {
+	if record, err := reader.QueryCursor.Read(); err == nil {
 		reader.id = fmt.Sprint(record.Get("Id"))
+		if reader.exportFiles != nil {
+			if err := reader.exportFile(record); err != nil {
+				return nil, err
+			}
+		}
 		return record, nil
 	} else {
 		return nil, err
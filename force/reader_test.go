@@ -0,0 +1,84 @@
+package force
+
+import (
+	"io"
+	"testing"
+)
+
+func TestReaderQueryMore(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	server.QueryBatchSize = 2
+	source := &SalesforceSource{Instance: "test", Query: "select Id, Name, ExtId__c from Account"}
+	if err := source.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := source.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if fields := reader.Fields(); len(fields) != 3 || fields[1] != "Name" {
+		t.Fatal("unexpected fields: ", fields)
+	}
+	names := make([]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, mustGet(t, record, "Name"))
+	}
+	if len(names) != 3 || names[2] != "Initech" {
+		t.Fatal("unexpected records: ", names)
+	}
+	if server.Calls("queryMore") != 1 {
+		t.Fatal("expected records read with queryMore")
+	}
+}
+
+func TestReaderSObject(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	source := &SalesforceSource{Instance: "test", SObject: "Account"}
+	if err := source.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := source.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mustGet(t, record, "ExtId__c") != "A1" || mustGet(t, record, "Type") != "Customer" {
+		t.Fatal("unexpected record: ", record)
+	}
+	if reader.Location() != "record Id: "+server.Records("Account")[0]["Id"] {
+		t.Fatal("unexpected location: ", reader.Location())
+	}
+}
+
+func TestReaderRelationship(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	writeContacts(t, "INSERT", []map[string]interface{}{{"LastName": "Smith", "Account:Account.ExtId__c": "A2"}})
+	source := &SalesforceSource{Instance: "test", Query: "select LastName, Account.Name from Contact"}
+	if err := source.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := source.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mustGet(t, record, "Account.Name") != "Globex" {
+		t.Fatal("unexpected record: ", record)
+	}
+}
@@ -0,0 +1,43 @@
+package force
+
+import (
+	. "github.com/goforce/api/commons"
+	"strings"
+)
+
+// mapRecord is a record not bound to sObject describe, fields are kept in the order they were set
+// and names are case insensitive.
+type mapRecord struct {
+	fields []string
+	values map[string]interface{}
+}
+
+func newMapRecord() *mapRecord {
+	return &mapRecord{fields: make([]string, 0), values: make(map[string]interface{})}
+}
+
+func (rec *mapRecord) Get(name string) (interface{}, bool) {
+	if v, ok := rec.values[strings.ToLower(name)]; ok {
+		return v, true
+	}
+	// nested records could be accessed using dot notation
+	if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+		if nested, ok := rec.values[strings.ToLower(parts[0])].(Record); ok {
+			return nested.Get(parts[1])
+		}
+	}
+	return nil, false
+}
+
+func (rec *mapRecord) Set(name string, value interface{}) (interface{}, error) {
+	key := strings.ToLower(name)
+	if _, ok := rec.values[key]; !ok {
+		rec.fields = append(rec.fields, name)
+	}
+	rec.values[key] = value
+	return value, nil
+}
+
+func (rec *mapRecord) Fields() []string {
+	return rec.fields
+}
@@ -0,0 +1,85 @@
+package force
+
+import (
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"strings"
+)
+
+// idResult is result of soap calls taking ids of records
+type idResult struct {
+	Success bool        `xml:"success"`
+	Id      string      `xml:"id"`
+	Errors  []soapError `xml:"errors"`
+}
+
+func recordIds(records []Record) []string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		if id, _ := record.Get("Id"); id != nil {
+			ids[i] = String(id)
+		}
+	}
+	return ids
+}
+
+// recycle calls undelete or emptyRecycleBin for ids of records
+func (writer *ForceWriter) recycle(operation string, ids []string) ([]DmlResult, error) {
+	s, err := writer.instance.restSession()
+	if err != nil {
+		return nil, err
+	}
+	var body strings.Builder
+	body.WriteString("<urn:" + operation + ">")
+	for _, id := range ids {
+		body.WriteString("<urn:ids>" + escapeXml(id) + "</urn:ids>")
+	}
+	body.WriteString("</urn:" + operation + ">")
+	var response struct {
+		Undelete        []idResult `xml:"undeleteResponse>result"`
+		EmptyRecycleBin []idResult `xml:"emptyRecycleBinResponse>result"`
+	}
+	if err := s.soap(operation, body.String(), &response); err != nil {
+		return nil, err
+	}
+	returned := response.Undelete
+	if operation == "emptyRecycleBin" {
+		returned = response.EmptyRecycleBin
+	}
+	results := make([]DmlResult, len(returned))
+	for i, r := range returned {
+		results[i] = DmlResult{Success: r.Success, Id: r.Id, Message: soapMessage(r.Errors)}
+	}
+	return results, nil
+}
+
+// hardDelete deletes records and removes them from recycle bin, records failed to be removed from recycle bin
+// are reported as errors while they stay deleted. It emulates hard delete of bulk api with two soap calls:
+// only the listed records are removed from recycle bin, children deleted by cascade delete stay there.
+func (writer *ForceWriter) hardDelete(records []Record) ([]DmlResult, error) {
+	results, err := writer.instance.connection.Delete(records)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([]int, 0, len(results))
+	ids := make([]string, 0, len(results))
+	for i, result := range results {
+		if result.Success {
+			deleted = append(deleted, i)
+			ids = append(ids, result.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return results, nil
+	}
+	// records are already deleted, failed call is reported for each record instead of failing the batch
+	emptied, err := writer.recycle("emptyRecycleBin", ids)
+	for i, j := range deleted {
+		if err != nil {
+			results[j] = DmlResult{Id: results[j].Id, Message: fmt.Sprint("deleted, but not removed from recycle bin: ", err)}
+		} else if i < len(emptied) && !emptied[i].Success {
+			results[j] = DmlResult{Id: results[j].Id, Message: fmt.Sprint("deleted, but not removed from recycle bin: ", emptied[i].Message)}
+		}
+	}
+	return results, nil
+}
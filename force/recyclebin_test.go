@@ -0,0 +1,55 @@
+package force
+
+import (
+	"io"
+	"testing"
+)
+
+func TestHardDeleteAndUndelete(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	accounts := server.Records("Account")
+	target := &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "DELETE"}
+	write(t, target, []string{"Id"}, []map[string]interface{}{{"Id": accounts[0]["Id"]}, {"Id": accounts[1]["Id"]}})
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "HARDDELETE"}
+	reports := write(t, target, []string{"Id"}, []map[string]interface{}{{"Id": accounts[2]["Id"]}, {"Id": accounts[0]["Id"]}})
+	if !reports[0].success || reports[1].success {
+		t.Fatal("unexpected hard delete results: ", reports[0].err, reports[1].err)
+	}
+	if len(server.Records("Account")) != 0 || len(server.Deleted("Account")) != 2 {
+		t.Fatal("expected record removed from recycle bin")
+	}
+	// records deleted earlier are read from recycle bin
+	source := &SalesforceSource{Instance: "test", Query: "select Id, Name from Account", QueryAll: true}
+	if err := source.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := source.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	rows := make([]map[string]interface{}, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, map[string]interface{}{"Id": mustGet(t, record, "Id")})
+	}
+	if len(rows) != 2 {
+		t.Fatal("expected deleted records read: ", rows)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UNDELETE"}
+	reports = write(t, target, []string{"Id"}, rows[:1])
+	if !reports[0].success || len(server.Records("Account")) != 1 {
+		t.Fatal("expected record restored: ", reports[0].err)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "EMPTYRECYCLEBIN"}
+	reports = write(t, target, []string{"Id"}, rows)
+	if reports[0].success || !reports[1].success || len(server.Deleted("Account")) != 0 {
+		t.Fatal("unexpected empty recycle bin results: ", reports[0].err, reports[1].err)
+	}
+}
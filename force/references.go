@@ -0,0 +1,37 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+)
+
+// References returns objects referenced by target fields, keyed by field name. Both nested fields like
+// Account:Account.ExtId__c and plain reference fields like AccountId are taken into account.
+func (target *SalesforceTarget) References(fields []string) (map[string][]string, error) {
+	if err := target.instance.connect(); err != nil {
+		return nil, errors.New(fmt.Sprint("not able to connect to target instance: ", target.Instance, "\n", err))
+	}
+	describe, err := target.instance.connection.DescribeSObject(target.SObject)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error describing SObject: ", target.SObject, "\n", err))
+	}
+	return fieldReferences(describe, fields)
+}
+
+// fieldReferences returns objects referenced by the fields of described object, fields not referencing are skipped.
+func fieldReferences(describe *DescribeSObjectResult, fields []string) (map[string][]string, error) {
+	references := make(map[string][]string)
+	for _, f := range fields {
+		_, referenceTo, err := nestedReference(describe, f)
+		if err != nil {
+			return nil, err
+		}
+		if referenceTo != "" {
+			references[f] = []string{referenceTo}
+		} else if fd := describe.Get(f); fd != nil && fd.Type == "reference" {
+			references[f] = fd.ReferenceTo
+		}
+	}
+	return references, nil
+}
@@ -0,0 +1,265 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MAX_COLLECTION_SIZE is max number of records in one sObject collections call
+const MAX_COLLECTION_SIZE int = 200
+
+// restConnection implements connection over rest api using sObject collections for dml. Describes are read
+// through soap api as they are returned in the same form as for soap connection.
+type restConnection struct {
+	describer Connection
+	session   *session
+	lock      sync.Mutex
+	describes map[string]*DescribeSObjectResult
+}
+
+type restCursor struct {
+	connection *restConnection
+	records    []map[string]interface{}
+	next       string
+}
+
+type collectionResult struct {
+	Id      string `json:"id"`
+	Success bool   `json:"success"`
+	Created bool   `json:"created"`
+	Errors  []struct {
+		StatusCode string   `json:"statusCode"`
+		Message    string   `json:"message"`
+		Fields     []string `json:"fields"`
+	} `json:"errors"`
+}
+
+func newRestConnection(describer Connection, session *session) *restConnection {
+	return &restConnection{describer: describer, session: session, describes: make(map[string]*DescribeSObjectResult)}
+}
+
+func (c *restConnection) DescribeSObject(name string) (*DescribeSObjectResult, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if describe, ok := c.describes[strings.ToLower(name)]; ok {
+		return describe, nil
+	}
+	describe, err := c.describer.DescribeSObject(name)
+	if err != nil {
+		return nil, err
+	}
+	c.describes[strings.ToLower(name)] = describe
+	return describe, nil
+}
+
+func (c *restConnection) Query(soql string) (QueryCursor, error) {
+	cursor := &restCursor{connection: c}
+	if err := cursor.fetch("/query?q=" + url.QueryEscape(soql)); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func (c *restConnection) QueryAll(soql string) (QueryCursor, error) {
+	cursor := &restCursor{connection: c}
+	if err := cursor.fetch("/queryAll?q=" + url.QueryEscape(soql)); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func (cursor *restCursor) fetch(path string) error {
+	var result struct {
+		Done           bool                     `json:"done"`
+		NextRecordsUrl string                   `json:"nextRecordsUrl"`
+		Records        []map[string]interface{} `json:"records"`
+	}
+	if _, err := cursor.connection.session.rest("GET", path, nil, &result); err != nil {
+		return err
+	}
+	cursor.records = result.Records
+	cursor.next = ""
+	if !result.Done {
+		cursor.next = result.NextRecordsUrl
+	}
+	return nil
+}
+
+func (cursor *restCursor) Read() (Record, error) {
+	for len(cursor.records) == 0 {
+		if cursor.next == "" {
+			return nil, io.EOF
+		}
+		if err := cursor.fetch(cursor.next); err != nil {
+			return nil, err
+		}
+	}
+	m := cursor.records[0]
+	cursor.records = cursor.records[1:]
+	return cursor.connection.record(m)
+}
+
+// record converts json record to record with values of the same types as returned by soap api
+func (c *restConnection) record(m map[string]interface{}) (Record, error) {
+	var describe *DescribeSObjectResult
+	if attributes, ok := m["attributes"].(map[string]interface{}); ok {
+		if t, ok := attributes["type"].(string); ok && t != "" {
+			var err error
+			if describe, err = c.DescribeSObject(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	record := newMapRecord()
+	for name, value := range m {
+		if name == "attributes" {
+			continue
+		}
+		switch value.(type) {
+		case map[string]interface{}:
+			nested := value.(map[string]interface{})
+			if children, ok := nested["records"].([]interface{}); ok {
+				// child relationship query
+				records := make([]Record, 0, len(children))
+				for _, child := range children {
+					if cm, ok := child.(map[string]interface{}); ok {
+						r, err := c.record(cm)
+						if err != nil {
+							return nil, err
+						}
+						records = append(records, r)
+					}
+				}
+				record.Set(name, records)
+				continue
+			}
+			r, err := c.record(nested)
+			if err != nil {
+				return nil, err
+			}
+			record.Set(name, r)
+		default:
+			var fd *FieldDescribe
+			if describe != nil {
+				fd = describe.Get(name)
+			}
+			v, err := restValue(fd, value)
+			if err != nil {
+				return nil, errors.New(fmt.Sprint(name, ": ", err))
+			}
+			record.Set(name, v)
+		}
+	}
+	return record, nil
+}
+
+func restValue(fd *FieldDescribe, value interface{}) (interface{}, error) {
+	if value == nil || fd == nil {
+		return value, nil
+	}
+	s := String(value)
+	switch fd.Type {
+	case "date":
+		return time.Parse("2006-01-02", s)
+	case "datetime":
+		return time.Parse("2006-01-02T15:04:05.000-0700", s)
+	case "int", "double", "currency", "percent":
+		if r, ok := new(big.Rat).SetString(s); ok {
+			return r, nil
+		}
+		return nil, errors.New(fmt.Sprint("not a number: ", s))
+	}
+	return value, nil
+}
+
+func (c *restConnection) Insert(sObject string, records []Record) ([]DmlResult, error) {
+	results, err := c.collection("POST", "/composite/sobjects", sObject, records)
+	// create response has no created flag, every saved record is created
+	for i := range results {
+		results[i].Created = results[i].Success
+	}
+	return results, err
+}
+
+func (c *restConnection) Update(sObject string, records []Record) ([]DmlResult, error) {
+	return c.collection("PATCH", "/composite/sobjects", sObject, records)
+}
+
+func (c *restConnection) Upsert(sObject string, records []Record, externalId string) ([]DmlResult, error) {
+	describe, err := c.DescribeSObject(sObject)
+	if err != nil {
+		return nil, err
+	}
+	return c.collection("PATCH", "/composite/sobjects/"+describe.Name+"/"+externalId, sObject, records)
+}
+
+func (c *restConnection) Delete(records []Record) ([]DmlResult, error) {
+	results := make([]DmlResult, 0, len(records))
+	for start := 0; start < len(records); start += MAX_COLLECTION_SIZE {
+		end := start + MAX_COLLECTION_SIZE
+		if end > len(records) {
+			end = len(records)
+		}
+		ids := make([]string, 0, end-start)
+		for _, r := range records[start:end] {
+			id, _ := r.Get("Id")
+			ids = append(ids, url.QueryEscape(String(id)))
+		}
+		var response []collectionResult
+		if _, err := c.session.rest("DELETE", "/composite/sobjects?allOrNone=false&ids="+strings.Join(ids, ","), nil, &response); err != nil {
+			return nil, err
+		}
+		results = append(results, dmlResults(response)...)
+	}
+	return results, nil
+}
+
+// collection sends records in chunks of MAX_COLLECTION_SIZE, failed records do not roll back others.
+func (c *restConnection) collection(method string, path string, sObject string, records []Record) ([]DmlResult, error) {
+	describe, err := c.DescribeSObject(sObject)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]DmlResult, 0, len(records))
+	for start := 0; start < len(records); start += MAX_COLLECTION_SIZE {
+		end := start + MAX_COLLECTION_SIZE
+		if end > len(records) {
+			end = len(records)
+		}
+		body := make([]interface{}, 0, end-start)
+		for _, r := range records[start:end] {
+			m := jsonRecord(describe, r)
+			m["attributes"] = map[string]interface{}{"type": describe.Name}
+			body = append(body, m)
+		}
+		var response []collectionResult
+		if _, err := c.session.rest(method, path, map[string]interface{}{"allOrNone": false, "records": body}, &response); err != nil {
+			return nil, err
+		}
+		results = append(results, dmlResults(response)...)
+	}
+	return results, nil
+}
+
+func dmlResults(response []collectionResult) []DmlResult {
+	results := make([]DmlResult, len(response))
+	for i, r := range response {
+		messages := make([]string, 0, len(r.Errors))
+		for _, e := range r.Errors {
+			message := e.StatusCode + ": " + e.Message
+			if len(e.Fields) > 0 {
+				message += " (" + strings.Join(e.Fields, ", ") + ")"
+			}
+			messages = append(messages, message)
+		}
+		results[i] = DmlResult{Success: r.Success, Created: r.Created, Id: r.Id, Message: strings.Join(messages, "; ")}
+	}
+	return results
+}
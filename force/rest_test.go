@@ -0,0 +1,143 @@
+package force
+
+import (
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/api/soap"
+	"github.com/goforce/reloader/force/forcetest"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRestWriter(t *testing.T) {
+	server := newApiTestServer(t, "rest")
+	defer server.Close()
+	reports := writeContacts(t, "INSERT", []map[string]interface{}{
+		{"LastName": "Smith", "Account:Account.ExtId__c": "A1"},
+		{"Email": "nobody@example.com"},
+	})
+	if !reports[0].success || !reports[0].created {
+		t.Fatal("expected record inserted: ", reports[0].err)
+	}
+	if reports[1].success || reports[1].err == "" {
+		t.Fatal("expected error of required field")
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UPSERT", ExternalId: "ExtId__c"}
+	reports = write(t, target, []string{"ExtId__c", "Name"}, []map[string]interface{}{
+		{"ExtId__c": "A1", "Name": "Acme Corp"},
+		{"ExtId__c": "A4", "Name": "Hooli"},
+	})
+	if reports[0].created || !reports[1].created {
+		t.Fatal("expected update and insert: ", reports[0].err, reports[1].err)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "DELETE"}
+	reports = write(t, target, []string{"Id"}, []map[string]interface{}{{"Id": reports[1].id}})
+	if !reports[0].success || len(server.Records("Account")) != 3 {
+		t.Fatal("expected account deleted: ", reports[0].err)
+	}
+	if server.Calls("create") != 0 || server.Calls("POST composite") != 1 {
+		t.Fatal("expected records written through rest api")
+	}
+}
+
+func TestRestRequestError(t *testing.T) {
+	server := newApiTestServer(t, "rest")
+	defer server.Close()
+	instance := salesforce.Instances["test"]
+	if err := instance.connect(); err != nil {
+		t.Fatal(err)
+	}
+	connection := instance.connection.(*restConnection)
+	connection.session.sessionId = "expired"
+	record, err := NewDescribedRecord(mustDescribe(t, connection, "Account"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("Name", "Hooli")
+	// error of the request is returned as array of errors, it should not be read as results of records
+	if _, err := connection.Insert("Account", []Record{record}); err == nil || !strings.Contains(err.Error(), "INVALID_SESSION_ID") {
+		t.Fatal("expected error of request: ", err)
+	}
+}
+
+func mustDescribe(t *testing.T, connection Connection, sObject string) *DescribeSObjectResult {
+	describe, err := connection.DescribeSObject(sObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return describe
+}
+
+func TestRestReader(t *testing.T) {
+	server := newApiTestServer(t, "rest")
+	defer server.Close()
+	server.QueryBatchSize = 2
+	writeContacts(t, "INSERT", []map[string]interface{}{{"LastName": "Smith", "Account:Account.ExtId__c": "A2"}})
+	source := &SalesforceSource{Instance: "test", Query: "select Id, Name from Account"}
+	if err := source.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := source.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for {
+		if _, err := reader.Read(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Fatal("unexpected number of records: ", count)
+	}
+	source = &SalesforceSource{Instance: "test", Query: "select LastName, Account.Name from Contact"}
+	source.Init(noresolve)
+	reader, err = source.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mustGet(t, record, "Account.Name") != "Globex" {
+		t.Fatal("unexpected record: ", record)
+	}
+	if server.Calls("query") != 0 || server.Calls("GET query") != 3 {
+		t.Fatal("expected records read through rest api")
+	}
+}
+
+func TestRestConnectOnce(t *testing.T) {
+	server := newApiTestServer(t, "rest")
+	defer server.Close()
+	instance := salesforce.Instances["test"]
+	connector := instance.connector
+	var lock sync.Mutex
+	connects := 0
+	instance.SetConnector(func(ins *Instance) (*soap.Connection, error) {
+		lock.Lock()
+		connects++
+		lock.Unlock()
+		return connector(ins)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := instance.restSession(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// rest session is created from the connection made by connector
+	if connects != 1 || instance.session == nil || instance.session.sessionId != forcetest.SESSION_ID {
+		t.Fatal("expected one connection sharing its session, got: ", connects)
+	}
+}
@@ -0,0 +1,411 @@
+package force
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const SAMPLE_IDS_PER_QUERY int = 200
+
+// Sample selects root records and all records related to them, so that extracted or copied data stays consistent.
+type Sample struct {
+	Label    string          `json:"label"`
+	Instance string          `json:"instance"`
+	Root     SampleRoot      `json:"root"`
+	Related  []*SampleObject `json:"related"`
+	Path     string          `json:"path"`
+	Target   string          `json:"target"`
+	instance *Instance
+	target   *Instance
+}
+
+type SampleRoot struct {
+	SObject string  `json:"sObject"`
+	Where   string  `json:"where"`
+	Percent float64 `json:"percent"`
+	Limit   int     `json:"limit"`
+}
+
+// SampleObject is an object related to the sampled ones. Fields lists reference fields to be followed,
+// if empty all reference fields pointing to already sampled objects are used.
+type SampleObject struct {
+	SObject string   `json:"sObject"`
+	Fields  []string `json:"fields"`
+	Where   string   `json:"where"`
+}
+
+// sampled keeps records of one object in the order they were read
+type sampled struct {
+	describe *DescribeSObjectResult
+	fields   []string
+	records  []Record
+	ids      map[string]bool
+}
+
+func (s *Sample) Init(resolver func(string) string) (err error) {
+	if s == nil {
+		return
+	}
+	s.Instance = resolver(s.Instance)
+	s.Target = resolver(s.Target)
+	s.Path = resolver(s.Path)
+	if s.Instance == "" {
+		return errors.New(fmt.Sprint("instance should be specified"))
+	}
+	if s.Root.SObject == "" {
+		return errors.New(fmt.Sprint("root sObject should be specified"))
+	}
+	if s.Root.Percent < 0 || s.Root.Percent > 100 {
+		return errors.New(fmt.Sprint("percent should be between 0 and 100"))
+	}
+	if s.Path == "" && s.Target == "" {
+		return errors.New(fmt.Sprint("either path or target should be specified"))
+	}
+	for _, r := range s.Related {
+		if r.SObject == "" {
+			return errors.New(fmt.Sprint("related sObject should be specified"))
+		}
+	}
+	if s.instance, err = resolveInstance(s.Instance); err != nil {
+		return err
+	}
+	if s.Target != "" {
+		s.target, err = resolveInstance(s.Target)
+	}
+	return
+}
+
+func (s *Sample) GetLabel() string {
+	if s.Label != "" {
+		return s.Label
+	}
+	return s.Instance + "-" + s.Root.SObject + "-sample"
+}
+
+// Execute reads sampled records and writes them to csv files and/or inserts them into target instance.
+func (s *Sample) Execute() error {
+	log.Println(commons.PROGRESS, "starting sample ", s.GetLabel())
+	if err := s.instance.connect(); err != nil {
+		return err
+	}
+	objects := make([]*sampled, 0, len(s.Related)+1)
+	root, err := s.readRoot()
+	if err != nil {
+		return err
+	}
+	objects = append(objects, root)
+	for _, r := range s.Related {
+		o, err := s.readRelated(r, objects)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, o)
+	}
+	if s.Path != "" {
+		for _, o := range objects {
+			if err := o.writeCsv(filepath.Join(s.Path, o.describe.Name+".csv")); err != nil {
+				return err
+			}
+		}
+	}
+	if s.target != nil {
+		if err := s.insert(objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sample) newSampled(sObject string) (*sampled, error) {
+	describe, err := s.instance.connection.DescribeSObject(sObject)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error describing SObject: ", sObject, "\n", err))
+	}
+	o := &sampled{describe: describe, records: make([]Record, 0), ids: make(map[string]bool)}
+	for _, fd := range describe.Fields {
+		if fd.Type != "address" && fd.Type != "location" && fd.Type != "base64" {
+			o.fields = append(o.fields, fd.Name)
+		}
+	}
+	return o, nil
+}
+
+func (o *sampled) add(record Record) bool {
+	id := String(o.get(record, "Id"))
+	if o.ids[id] {
+		return false
+	}
+	o.ids[id] = true
+	o.records = append(o.records, record)
+	return true
+}
+
+func (o *sampled) get(record Record, field string) interface{} {
+	v, _ := record.Get(field)
+	return v
+}
+
+// readRoot selects ids of sampled root records first, reading stops when limit is reached. Only records in sample
+// are read with all fields.
+func (s *Sample) readRoot() (*sampled, error) {
+	root, err := s.newSampled(s.Root.SObject)
+	if err != nil {
+		return nil, err
+	}
+	soql := "select Id from " + root.describe.Name
+	if s.Root.Where != "" {
+		soql += " where " + s.Root.Where
+	}
+	if s.Root.Limit > 0 && s.Root.Percent == 0 {
+		soql += " limit " + strconv.Itoa(s.Root.Limit)
+	}
+	cursor, err := s.instance.connection.Query(soql)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	read := 0
+	for s.Root.Limit == 0 || len(ids) < s.Root.Limit {
+		record, err := cursor.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		read++
+		id := String(root.get(record, "Id"))
+		if s.Root.Percent > 0 && !inSample(id, s.Root.Percent) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	records := make(map[string]Record)
+	for start := 0; start < len(ids); start += SAMPLE_IDS_PER_QUERY {
+		end := start + SAMPLE_IDS_PER_QUERY
+		if end > len(ids) {
+			end = len(ids)
+		}
+		quoted := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			quoted = append(quoted, "'"+escapeSoql(id)+"'")
+		}
+		soql := "select " + strings.Join(root.fields, ",") + " from " + root.describe.Name +
+			" where Id in (" + strings.Join(quoted, ",") + ")"
+		batch, err := readAll(s.instance.connection.Query(soql))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range batch {
+			records[String(root.get(record, "Id"))] = record
+		}
+	}
+	// keep order the ids were read in
+	for _, id := range ids {
+		if record, ok := records[id]; ok {
+			root.add(record)
+		}
+	}
+	log.Println(commons.PROGRESS, "sampled ", len(root.records), " of ", read, " ", root.describe.Name)
+	return root, nil
+}
+
+// inSample decides by hash of the id if record is in sample, so the same records are sampled on every run.
+func inSample(id string, percent float64) bool {
+	if len(id) > 15 {
+		id = id[:15]
+	}
+	h := sha1.Sum([]byte(id))
+	return float64(binary.BigEndian.Uint32(h[:])%10000) < percent*100
+}
+
+func (s *Sample) readRelated(r *SampleObject, parents []*sampled) (*sampled, error) {
+	o, err := s.newSampled(r.SObject)
+	if err != nil {
+		return nil, err
+	}
+	// find reference fields and sampled objects they are pointing to
+	references := make(map[string]*sampled)
+	for _, fd := range o.describe.Fields {
+		if fd.Type != "reference" {
+			continue
+		}
+		if len(r.Fields) > 0 && !commons.ContainsFold(r.Fields, fd.Name) {
+			continue
+		}
+		for _, to := range fd.ReferenceTo {
+			for _, p := range parents {
+				if strings.EqualFold(p.describe.Name, to) {
+					references[fd.Name] = p
+				}
+			}
+		}
+	}
+	for _, f := range r.Fields {
+		if fd := o.describe.Get(f); fd == nil || references[fd.Name] == nil {
+			return nil, errors.New(fmt.Sprint(r.SObject, ".", f, " is not a reference to sampled object"))
+		}
+	}
+	if len(references) == 0 {
+		return nil, errors.New(fmt.Sprint("no references from ", r.SObject, " to sampled objects"))
+	}
+	// fields are sorted, so records are read in the same order in every run
+	fields := make([]string, 0, len(references))
+	for field := range references {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		parent := references[field]
+		ids := make([]string, 0, len(parent.records))
+		for _, p := range parent.records {
+			ids = append(ids, "'"+escapeSoql(String(parent.get(p, "Id")))+"'")
+		}
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > SAMPLE_IDS_PER_QUERY {
+				n = SAMPLE_IDS_PER_QUERY
+			}
+			soql := "select " + strings.Join(o.fields, ",") + " from " + o.describe.Name +
+				" where " + field + " in (" + strings.Join(ids[:n], ",") + ")"
+			if r.Where != "" {
+				soql += " and (" + r.Where + ")"
+			}
+			ids = ids[n:]
+			records, err := readAll(s.instance.connection.Query(soql))
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				o.add(record)
+			}
+		}
+	}
+	log.Println(commons.PROGRESS, "sampled ", len(o.records), " related ", o.describe.Name)
+	return o, nil
+}
+
+func (o *sampled) writeCsv(path string) error {
+	rows := make([][]string, 0, len(o.records))
+	for _, record := range o.records {
+		row := make([]string, len(o.fields))
+		for i, f := range o.fields {
+			if v := o.get(record, f); v != nil {
+				row[i] = String(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return writeCsvFile(path, o.fields, rows)
+}
+
+func writeCsvFile(path string, header []string, rows [][]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.New(fmt.Sprint("cannot create file: ", path, " : ", err))
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	w.Write(header)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		return errors.New(fmt.Sprint("error writing file: ", path, " : ", err))
+	}
+	log.Println(commons.PROGRESS, "written ", len(rows), " records to ", path)
+	return nil
+}
+
+// insert copies sampled records into target instance in the order of objects, references to already inserted
+// records are remapped to new ids. References to records not in the sample are left empty, their ids do not exist
+// in the target instance.
+func (s *Sample) insert(objects []*sampled) error {
+	if err := s.target.connect(); err != nil {
+		return err
+	}
+	newIds := make(map[string]string)
+	for _, o := range objects {
+		describe, err := s.target.connection.DescribeSObject(o.describe.Name)
+		if err != nil {
+			return errors.New(fmt.Sprint("error describing SObject: ", o.describe.Name, "\n", err))
+		}
+		fields := make([]*FieldDescribe, 0)
+		for _, f := range o.fields {
+			if fd := describe.Get(f); fd != nil && fd.Createable {
+				fields = append(fields, fd)
+			}
+		}
+		inserted, failed, unresolved := 0, 0, 0
+		for start := 0; start < len(o.records); start += MAX_BATCH_SIZE {
+			end := start + MAX_BATCH_SIZE
+			if end > len(o.records) {
+				end = len(o.records)
+			}
+			batch := make([]Record, 0, end-start)
+			for _, source := range o.records[start:end] {
+				record, err := NewDescribedRecord(describe)
+				if err != nil {
+					return err
+				}
+				for _, fd := range fields {
+					value := o.get(source, fd.Name)
+					if value == nil || String(value) == "" {
+						continue
+					}
+					if fd.Type == "reference" {
+						id, ok := newIds[shortId(String(value))]
+						if !ok {
+							unresolved++
+							continue
+						}
+						value = id
+					}
+					if _, err := record.Set(fd.Name, value); err != nil {
+						return errors.New(fmt.Sprint(o.describe.Name, ".", fd.Name, ": ", err))
+					}
+				}
+				batch = append(batch, record)
+			}
+			if err := s.target.checkBudget(); err != nil {
+				return err
+			}
+			results, err := s.target.connection.Insert(o.describe.Name, batch)
+			if err != nil {
+				return errors.New(fmt.Sprint("error inserting ", o.describe.Name, ": ", err))
+			}
+			for i, result := range results {
+				oldId := String(o.get(o.records[start+i], "Id"))
+				if result.Success {
+					newIds[shortId(oldId)] = result.Id
+					inserted++
+				} else {
+					log.Println(commons.ERRORS, "error inserting ", o.describe.Name, " ", oldId, ": ", result.Message)
+					failed++
+				}
+			}
+		}
+		log.Println(commons.PROGRESS, "inserted ", inserted, " ", o.describe.Name, ", failed: ", failed,
+			", references not in sample: ", unresolved)
+	}
+	return nil
+}
+
+func shortId(id string) string {
+	if len(id) > 15 {
+		return id[:15]
+	}
+	return id
+}
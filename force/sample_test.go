@@ -0,0 +1,55 @@
+package force
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleRootLimit(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	path := t.TempDir()
+	sample := &Sample{Instance: "test", Root: SampleRoot{SObject: "Account", Limit: 2}, Path: path}
+	if err := sample.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	if err := sample.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(path, "Account.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatal("expected header and two sampled accounts, got: ", len(rows))
+	}
+	// ids are selected first, then sampled records are read with all fields
+	if server.Calls("query") != 2 {
+		t.Fatal("unexpected number of queries: ", server.Calls("query"))
+	}
+}
+
+func TestSampleInsertReferences(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	writeContacts(t, "INSERT", []map[string]interface{}{{"LastName": "Smith", "Account:Account.ExtId__c": "A1"}})
+	// accounts are not in the sample, their ids are not copied to the new contact
+	sample := &Sample{Instance: "test", Root: SampleRoot{SObject: "Contact"}, Target: "test"}
+	if err := sample.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	if err := sample.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	contacts := server.Records("Contact")
+	if len(contacts) != 2 || contacts[0]["AccountId"] == "" || contacts[1]["AccountId"] != "" || contacts[1]["LastName"] != "Smith" {
+		t.Fatal("expected copy of contact without account: ", contacts)
+	}
+}
@@ -0,0 +1,215 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"sort"
+	"strings"
+)
+
+// SchemaDiff lists differences of sObjects between two instances
+type SchemaDiff struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Objects []*ObjectDiff `json:"objects"`
+}
+
+// ObjectDiff lists differences of fields of one sObject, Missing is from or to when object is not described there.
+type ObjectDiff struct {
+	SObject string       `json:"sObject"`
+	Missing string       `json:"missing,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Fields  []*FieldDiff `json:"fields"`
+	from    *DescribeSObjectResult
+	to      *DescribeSObjectResult
+}
+
+// FieldDiff is one difference of a field, like type, length or picklist values. For picklists From and To
+// are values existing only in that instance.
+type FieldDiff struct {
+	Field      string `json:"field"`
+	Difference string `json:"difference"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// DiffSchema describes objects in both instances and compares their fields.
+func DiffSchema(from string, to string, objects []string) (*SchemaDiff, error) {
+	instances := make([]*Instance, 2)
+	for i, name := range []string{from, to} {
+		instance, err := resolveInstance(name)
+		if err != nil {
+			return nil, err
+		}
+		if instance == nil {
+			return nil, errors.New("both instances should be specified")
+		}
+		if err := instance.connect(); err != nil {
+			return nil, errors.New(fmt.Sprint("not able to connect to instance: ", name, "\n", err))
+		}
+		instances[i] = instance
+	}
+	diff := &SchemaDiff{From: from, To: to, Objects: make([]*ObjectDiff, 0, len(objects))}
+	for _, sObject := range objects {
+		od := &ObjectDiff{SObject: sObject, Fields: make([]*FieldDiff, 0)}
+		var errFrom, errTo error
+		od.from, errFrom = instances[0].connection.DescribeSObject(sObject)
+		od.to, errTo = instances[1].connection.DescribeSObject(sObject)
+		if errFrom != nil && errTo != nil {
+			return nil, errors.New(fmt.Sprint("error describing ", sObject, " in both instances: ", errFrom))
+		} else if errFrom != nil {
+			od.Missing, od.Error, od.from = "from", errFrom.Error(), nil
+		} else if errTo != nil {
+			od.Missing, od.Error, od.to = "to", errTo.Error(), nil
+		} else {
+			od.Fields = diffFields(od.from, od.to)
+		}
+		diff.Objects = append(diff.Objects, od)
+	}
+	return diff, nil
+}
+
+func diffFields(from *DescribeSObjectResult, to *DescribeSObjectResult) []*FieldDiff {
+	diffs := make([]*FieldDiff, 0)
+	add := func(field string, difference string, f interface{}, t interface{}) {
+		diffs = append(diffs, &FieldDiff{Field: field, Difference: difference, From: fmt.Sprint(f), To: fmt.Sprint(t)})
+	}
+	for _, ff := range from.Fields {
+		tf := to.Get(ff.Name)
+		if tf == nil {
+			add(ff.Name, "missing", ff.Type, "")
+			continue
+		}
+		if ff.Type != tf.Type {
+			add(ff.Name, "type", ff.Type, tf.Type)
+			continue
+		}
+		if ff.Length != tf.Length {
+			add(ff.Name, "length", ff.Length, tf.Length)
+		}
+		if ff.Precision != tf.Precision || ff.Scale != tf.Scale {
+			add(ff.Name, "precision", fmt.Sprint(ff.Precision, ",", ff.Scale), fmt.Sprint(tf.Precision, ",", tf.Scale))
+		}
+		if fr, tr := strings.Join(ff.ReferenceTo, ","), strings.Join(tf.ReferenceTo, ","); fr != tr {
+			add(ff.Name, "referenceTo", fr, tr)
+		}
+		if ff.Nillable != tf.Nillable {
+			add(ff.Name, "nillable", ff.Nillable, tf.Nillable)
+		}
+		if ff.Createable != tf.Createable {
+			add(ff.Name, "createable", ff.Createable, tf.Createable)
+		}
+		if ff.Updateable != tf.Updateable {
+			add(ff.Name, "updateable", ff.Updateable, tf.Updateable)
+		}
+		if onlyFrom, onlyTo := picklistDiff(ff, tf); len(onlyFrom) > 0 || len(onlyTo) > 0 {
+			add(ff.Name, "picklist", strings.Join(onlyFrom, ";"), strings.Join(onlyTo, ";"))
+		}
+	}
+	for _, tf := range to.Fields {
+		if from.Get(tf.Name) == nil {
+			add(tf.Name, "added", "", tf.Type)
+		}
+	}
+	return diffs
+}
+
+// picklistDiff returns picklist values existing only in one of the fields, values are compared case insensitive
+func picklistDiff(from *FieldDescribe, to *FieldDescribe) ([]string, []string) {
+	values := func(fd *FieldDescribe) map[string]string {
+		m := make(map[string]string)
+		for _, v := range fd.PicklistValues {
+			m[strings.ToLower(v.Value)] = v.Value
+		}
+		return m
+	}
+	only := func(a map[string]string, b map[string]string) []string {
+		s := make([]string, 0)
+		for k, v := range a {
+			if _, ok := b[k]; !ok {
+				s = append(s, v)
+			}
+		}
+		sort.Strings(s)
+		return s
+	}
+	fv, tv := values(from), values(to)
+	return only(fv, tv), only(tv, fv)
+}
+
+// Summary returns human readable lines of differences
+func (diff *SchemaDiff) Summary() []string {
+	lines := make([]string, 0)
+	for _, od := range diff.Objects {
+		switch {
+		case od.Missing == "from":
+			lines = append(lines, fmt.Sprint(od.SObject, ": missing in ", diff.From, ": ", od.Error))
+			continue
+		case od.Missing == "to":
+			lines = append(lines, fmt.Sprint(od.SObject, ": missing in ", diff.To, ": ", od.Error))
+			continue
+		case len(od.Fields) == 0:
+			lines = append(lines, fmt.Sprint(od.SObject, ": no differences"))
+			continue
+		}
+		lines = append(lines, fmt.Sprint(od.SObject, ": ", len(od.Fields), " differences"))
+		for _, fd := range od.Fields {
+			switch fd.Difference {
+			case "missing":
+				lines = append(lines, fmt.Sprint("  ", fd.Field, ": missing in ", diff.To))
+			case "added":
+				lines = append(lines, fmt.Sprint("  ", fd.Field, ": exists only in ", diff.To))
+			case "picklist":
+				line := fmt.Sprint("  ", fd.Field, ": picklist values")
+				if fd.From != "" {
+					line += fmt.Sprint(" only in ", diff.From, ": ", fd.From)
+				}
+				if fd.To != "" {
+					line += fmt.Sprint(" only in ", diff.To, ": ", fd.To)
+				}
+				lines = append(lines, line)
+			default:
+				lines = append(lines, fmt.Sprint("  ", fd.Field, ": ", fd.Difference, " ", fd.From, " -> ", fd.To))
+			}
+		}
+	}
+	return lines
+}
+
+// JobWarnings returns warnings about target fields of a job writing to sObject of the to instance: fields missing
+// in the target and fields differing between instances. Object should be one of the compared objects.
+func (diff *SchemaDiff) JobWarnings(sObject string, fields []string) []string {
+	warnings := make([]string, 0)
+	var od *ObjectDiff
+	for _, o := range diff.Objects {
+		if strings.EqualFold(o.SObject, sObject) {
+			od = o
+		}
+	}
+	if od == nil {
+		return append(warnings, fmt.Sprint("target object ", sObject, " was not compared"))
+	}
+	if od.to == nil {
+		return append(warnings, fmt.Sprint("target object ", sObject, " is missing in ", diff.To))
+	}
+	for _, f := range fields {
+		name := topLevelFields([]string{f})[0]
+		var fd *FieldDescribe
+		if strings.Contains(f, ".") {
+			fd = od.to.GetRelationship(name)
+		} else {
+			fd = od.to.Get(name)
+		}
+		if fd == nil {
+			warnings = append(warnings, fmt.Sprint(f, ": mapped field is missing in ", sObject, " of ", diff.To))
+			continue
+		}
+		for _, d := range od.Fields {
+			if strings.EqualFold(d.Field, fd.Name) && d.Difference != "added" {
+				warnings = append(warnings, fmt.Sprint(f, ": ", d.Difference, " differs, ", diff.From, ": ", d.From, ", ", diff.To, ": ", d.To))
+			}
+		}
+	}
+	return warnings
+}
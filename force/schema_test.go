@@ -0,0 +1,63 @@
+package force
+
+import (
+	"github.com/goforce/api/soap"
+	"github.com/goforce/reloader/force/forcetest"
+	"strings"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	from := forcetest.NewServer(testObjects()...)
+	defer from.Close()
+	// target org has shorter name, one more account type, no email of contact and no leads
+	objects := testObjects()
+	objects[0].Fields = []*forcetest.Field{
+		&forcetest.Field{Name: "Name", Type: "string", Length: 80, Required: true},
+		&forcetest.Field{Name: "Type", Type: "picklist", Picklist: []string{"Customer", "Partner", "Prospect"}, Restricted: true},
+		&forcetest.Field{Name: "ExtId__c", Type: "string", ExternalId: true},
+		&forcetest.Field{Name: "Rating", Type: "picklist"},
+	}
+	objects[1].Fields = objects[1].Fields[:1]
+	to := forcetest.NewServer(append(objects[:2], objects[3:]...)...)
+	defer to.Close()
+	config := &Salesforce{Instances: make(map[string]*Instance)}
+	for name, server := range map[string]*forcetest.Server{"from": from, "to": to} {
+		instance := &Instance{Url: server.URL, Username: forcetest.USERNAME, Password: forcetest.PASSWORD}
+		instance.SetConnector(func(ins *Instance) (*soap.Connection, error) {
+			return soap.Login(ins.Url, ins.Username, ins.Password+ins.Token)
+		})
+		config.Instances[name] = instance
+	}
+	if err := config.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := DiffSchema("from", "to", []string{"Account", "Contact", "Lead"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Objects) != 3 || diff.Objects[2].Missing != "to" {
+		t.Fatal("expected lead missing in target: ", diff.Objects)
+	}
+	account := diff.Objects[0].Fields
+	if len(account) != 3 {
+		t.Fatal("unexpected differences of account: ", account)
+	}
+	if d := account[0]; d.Field != "Name" || d.Difference != "length" || d.From != "255" || d.To != "80" {
+		t.Fatal("unexpected difference: ", d)
+	}
+	if d := account[1]; d.Field != "Type" || d.Difference != "picklist" || d.From != "" || d.To != "Prospect" {
+		t.Fatal("unexpected difference: ", d)
+	}
+	if d := account[2]; d.Field != "Rating" || d.Difference != "added" {
+		t.Fatal("unexpected difference: ", d)
+	}
+	summary := strings.Join(diff.Summary(), "\n")
+	if !strings.Contains(summary, "Email: missing in to") || !strings.Contains(summary, "Lead: missing in to") {
+		t.Fatal("unexpected summary: ", summary)
+	}
+	warnings := diff.JobWarnings("Contact", []string{"LastName", "Email", "Account:Account.ExtId__c"})
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "Email: mapped field is missing") || !strings.HasPrefix(warnings[1], "Account:Account.ExtId__c") {
+		t.Fatal("unexpected warnings: ", warnings)
+	}
+}
@@ -0,0 +1,190 @@
+package force
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/goforce/api/soap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	API_VERSION  string        = "46.0"
+	HTTP_TIMEOUT time.Duration = 10 * time.Minute
+)
+
+// session is used for calls not covered by soap connection: rest api and raw soap calls.
+// It uses the session of connection of the instance.
+type session struct {
+	instanceUrl string
+	serverUrl   string
+	sessionId   string
+	client      *http.Client
+	usage       *apiUsage
+}
+
+type soapFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+func (f *soapFault) Error() string {
+	return fmt.Sprint(f.Code, ": ", f.String)
+}
+
+// loginUrl returns soap endpoint used to login into instance.
+func loginUrl(instanceUrl string) string {
+	if strings.Contains(instanceUrl, "/services/Soap/") {
+		return instanceUrl
+	}
+	return strings.TrimRight(instanceUrl, "/") + "/services/Soap/u/" + API_VERSION
+}
+
+// connectionSession is implemented by soap connections exposing their session, so rest calls do not login again.
+type connectionSession interface {
+	GetServerUrl() string
+	GetSessionId() string
+}
+
+// newSession creates session sharing session of the connection made by connector of the instance. Connections not
+// exposing their session are followed by login using credentials of the instance.
+func newSession(instance *Instance, connection *soap.Connection) (*session, error) {
+	s := &session{client: &http.Client{Timeout: HTTP_TIMEOUT}, usage: &instance.usage}
+	if c, ok := interface{}(connection).(connectionSession); ok && connection != nil && c.GetSessionId() != "" {
+		s.serverUrl = c.GetServerUrl()
+		s.sessionId = c.GetSessionId()
+	} else if err := s.login(instance); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(s.serverUrl)
+	if err != nil {
+		return nil, err
+	}
+	s.instanceUrl = u.Scheme + "://" + u.Host
+	return s, nil
+}
+
+func (s *session) login(instance *Instance) error {
+	var body bytes.Buffer
+	body.WriteString(`<urn:login><urn:username>`)
+	xml.EscapeText(&body, []byte(instance.Username))
+	body.WriteString(`</urn:username><urn:password>`)
+	xml.EscapeText(&body, []byte(instance.Password+instance.Token))
+	body.WriteString(`</urn:password></urn:login>`)
+	var result struct {
+		ServerUrl string `xml:"loginResponse>result>serverUrl"`
+		SessionId string `xml:"loginResponse>result>sessionId"`
+	}
+	if err := s.call(loginUrl(instance.Url), "login", "", body.String(), &result); err != nil {
+		return errors.New(fmt.Sprint("error logging in: ", err))
+	}
+	s.serverUrl = result.ServerUrl
+	s.sessionId = result.SessionId
+	return nil
+}
+
+// soap calls soap api with body of the envelope, result should be a struct describing content of soap body.
+func (s *session) soap(action string, body string, result interface{}) error {
+	s.usage.count()
+	header := `<urn:SessionHeader><urn:sessionId>` + s.sessionId + `</urn:sessionId></urn:SessionHeader>`
+	return s.call(s.serverUrl, action, header, body, result)
+}
+
+func (s *session) call(endpoint string, action string, header string, body string, result interface{}) error {
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`xmlns:urn="urn:partner.soap.sforce.com" xmlns:urn1="urn:sobject.partner.soap.sforce.com" ` +
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<soapenv:Header>` + header + `</soapenv:Header><soapenv:Body>` + body + `</soapenv:Body></soapenv:Envelope>`
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
+	req.Header.Set("SOAPAction", action)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Body struct {
+			Fault   *soapFault `xml:"Fault"`
+			Content []byte     `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return errors.New(fmt.Sprint("error parsing soap response: ", resp.Status, " ", err))
+	}
+	if response.Body.Fault != nil {
+		return response.Body.Fault
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprint("soap call failed: ", resp.Status))
+	}
+	if result == nil {
+		return nil
+	}
+	return xml.Unmarshal([]byte("<body>"+string(response.Body.Content)+"</body>"), result)
+}
+
+// rest calls rest api, path is relative to /services/data/vXX.X. Body is sent as json and response is parsed into
+// result. Status code is returned along with errors, response of failed calls is parsed into result too.
+func (s *session) rest(method string, path string, body interface{}, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	if !strings.HasPrefix(path, "/services/") {
+		path = "/services/data/v" + API_VERSION + path
+	}
+	req, err := http.NewRequest(method, s.instanceUrl+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.sessionId)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// limits resource does not count against api requests
+	if path != "/services/data/v"+API_VERSION+"/limits" {
+		s.usage.count()
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	s.usage.limitInfo(resp.Header)
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if result != nil && len(data) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(result); err != nil && resp.StatusCode < 300 {
+			return resp.StatusCode, errors.New(fmt.Sprint("error parsing response: ", err))
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New(fmt.Sprint(resp.Status, ": ", string(data)))
+	}
+	return resp.StatusCode, nil
+}
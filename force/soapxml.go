@@ -0,0 +1,78 @@
+package force
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"strings"
+)
+
+// soapError is error of a record returned by raw soap calls
+type soapError struct {
+	StatusCode string   `xml:"statusCode"`
+	Message    string   `xml:"message"`
+	Fields     []string `xml:"fields"`
+}
+
+func soapMessage(errs []soapError) string {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, e.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func escapeXml(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// soapRecord returns content of sObject element of partner api for the record. Fields with nil values are sent as
+// fieldsToNull, nested fields like Account:Account.ExtId__c or Account.ExtId__c reference records by external id.
+func soapRecord(describe *DescribeSObjectResult, nested map[string]*DescribeSObjectResult, record Record) string {
+	var id, fields, nulls bytes.Buffer
+	references := make(map[string]*bytes.Buffer)
+	order := make([]string, 0)
+	for _, f := range record.Fields() {
+		value, _ := record.Get(f)
+		if parts := strings.SplitN(f, ".", 2); len(parts) == 2 {
+			ts := strings.Split(parts[0], ":")
+			b, ok := references[ts[0]]
+			if !ok {
+				b = &bytes.Buffer{}
+				references[ts[0]] = b
+				order = append(order, ts[0])
+				referenceTo := ""
+				if len(ts) > 1 {
+					referenceTo = ts[1]
+				} else if fd := describe.GetRelationship(ts[0]); fd != nil && len(fd.ReferenceTo) > 0 {
+					referenceTo = fd.ReferenceTo[0]
+				}
+				b.WriteString("<urn1:type>" + escapeXml(referenceTo) + "</urn1:type>")
+			}
+			b.WriteString("<" + parts[1] + ">" + escapeXml(fmt.Sprint(jsonValue(nil, value))) + "</" + parts[1] + ">")
+			continue
+		}
+		if r, ok := value.(Record); ok {
+			if len(r.Fields()) > 0 && nested[f] != nil {
+				fields.WriteString("<" + f + ">" + "<urn1:type>" + nested[f].Name + "</urn1:type>" + soapRecord(nested[f], nil, r) + "</" + f + ">")
+			}
+			continue
+		}
+		if value == nil {
+			nulls.WriteString("<urn1:fieldsToNull>" + escapeXml(f) + "</urn1:fieldsToNull>")
+			continue
+		}
+		if strings.EqualFold(f, "Id") {
+			id.WriteString("<urn1:Id>" + escapeXml(String(value)) + "</urn1:Id>")
+			continue
+		}
+		fields.WriteString("<" + f + ">" + escapeXml(fmt.Sprint(jsonValue(describe.Get(f), value))) + "</" + f + ">")
+	}
+	for _, name := range order {
+		fields.WriteString("<" + name + ">" + references[name].String() + "</" + name + ">")
+	}
+	return nulls.String() + id.String() + fields.String()
+}
@@ -114,6 +114,27 @@ func SoqlFields(soql string) []string {
 	return fields
 }
 
+// SoqlObject returns name of the object in the from clause of the soql
+func SoqlObject(soql string) string {
+	scanner := &scanner{reader: strings.NewReader(soql), buff: make([]rune, 0, len(soql))}
+	for {
+		token := scanner.read()
+		if token == "" {
+			panic(message(soql, "no from clause", token))
+		} else if token == "(" {
+			if !scanner.skipInParentheses() {
+				panic(message(soql, "no closing parenthesis", token))
+			}
+		} else if strings.EqualFold(token, "from") {
+			object := scanner.read()
+			if object == "" || object == "," || object == "(" {
+				panic(message(soql, "no object in from clause", object))
+			}
+			return object
+		}
+	}
+}
+
 func message(soql string, cause string, token string) string {
 	return fmt.Sprint("failed to parse soql: ", soql, "\n>>> ", cause, ": ", token)
 }
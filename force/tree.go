@@ -0,0 +1,360 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/goforce/api/commons"
+	"github.com/goforce/eval"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"strings"
+)
+
+const MAX_TREE_RECORDS int = 200
+
+// SalesforceTree is a target writing parent records together with their child records using sObject tree api.
+// Rules with targets prefixed by child relationship name, like OrderItems.Quantity, set fields of child records.
+// Consecutive source rows with the same value of key field are written as one parent with children of all rows.
+type SalesforceTree struct {
+	Instance string       `json:"instance"`
+	SObject  string       `json:"sObject"`
+	Key      string       `json:"key"`
+	Children []*TreeChild `json:"children"`
+	instance *Instance
+	target   *SalesforceTarget
+}
+
+type TreeChild struct {
+	Relationship string `json:"relationship"`
+	SObject      string `json:"sObject"`
+}
+
+type treeChildRecord struct {
+	relationship string
+	ref          string
+	record       *mapRecord
+}
+
+type treeRow struct {
+	report commons.Report
+	refs   []string
+}
+
+type treeNode struct {
+	key      string
+	ref      string
+	record   *mapRecord
+	children []*treeChildRecord
+	rows     []*treeRow
+}
+
+type TreeWriter struct {
+	instance     *Instance
+	describe     *DescribeSObjectResult
+	children     []*TreeChild
+	describes    map[string]*DescribeSObjectResult
+	fields       []string
+	key          string
+	current      *treeNode
+	batch        []*treeNode
+	batchRecords int
+	refSeq       int
+	test         bool
+}
+
+func (t *SalesforceTree) Init(resolver func(string) string) (err error) {
+	if t == nil {
+		return
+	}
+	t.Instance = resolver(t.Instance)
+	if t.Instance == "" {
+		return errors.New(fmt.Sprint("instance should be specified"))
+	}
+	if t.SObject == "" {
+		return errors.New(fmt.Sprint("target sObject should be specified"))
+	}
+	if len(t.Children) == 0 {
+		return errors.New(fmt.Sprint("at least one child relationship should be specified"))
+	}
+	for _, c := range t.Children {
+		if c.Relationship == "" || c.SObject == "" {
+			return errors.New(fmt.Sprint("relationship and sObject should be specified for each child"))
+		}
+	}
+	t.instance, err = resolveInstance(t.Instance)
+	t.target = &SalesforceTarget{Instance: t.Instance, SObject: t.SObject, instance: t.instance, lookups: make(map[string]commons.Scan)}
+	return
+}
+
+func (t *SalesforceTree) GetLabel() string {
+	if t != nil {
+		return t.Instance + "-" + t.SObject + "-tree"
+	}
+	return ""
+}
+
+func (t *SalesforceTree) NewValuesSupplier() eval.Values {
+	return t.target.NewValuesSupplier()
+}
+
+func (t *SalesforceTree) NewFunctionsSupplier() eval.Functions {
+	return t.target.NewFunctionsSupplier()
+}
+
+func (t *SalesforceTree) NewWriter(fields []string) (commons.Writer, error) {
+	log.Println(commons.PROGRESS, fmt.Sprint("creating salesforce tree target: ", t.Instance))
+	if err := t.instance.connect(); err != nil {
+		return nil, errors.New(fmt.Sprint("not able to connect to target instance: ", t.Instance, "\n", err))
+	}
+	writer := &TreeWriter{
+		instance:  t.instance,
+		children:  t.Children,
+		describes: make(map[string]*DescribeSObjectResult),
+		fields:    fields,
+		key:       t.Key,
+		batch:     make([]*treeNode, 0),
+	}
+	var err error
+	writer.describe, err = t.instance.connection.DescribeSObject(t.SObject)
+	if err != nil {
+		return nil, errors.New(fmt.Sprint("error describing SObject: ", t.SObject, "\n", err))
+	}
+	for _, c := range t.Children {
+		d, err := t.instance.connection.DescribeSObject(c.SObject)
+		if err != nil {
+			return nil, errors.New(fmt.Sprint("error describing SObject: ", c.SObject, "\n", err))
+		}
+		writer.describes[strings.ToLower(c.Relationship)] = d
+	}
+	return writer, nil
+}
+
+func (writer *TreeWriter) SetTest(test bool) {
+	writer.test = test
+}
+
+func (writer *TreeWriter) Fields() []string {
+	return writer.fields
+}
+
+func (writer *TreeWriter) NewRecord() commons.Record {
+	return newMapRecord()
+}
+
+func (writer *TreeWriter) nextRef(prefix string) string {
+	writer.refSeq++
+	return fmt.Sprint(prefix, writer.refSeq)
+}
+
+func (writer *TreeWriter) Write(record commons.Record, report commons.Report, context eval.Context) error {
+	report.Output(record)
+	// split fields between parent and children
+	parent := newMapRecord()
+	children := make(map[string]*mapRecord)
+	for _, f := range record.Fields() {
+		value, _ := record.Get(f)
+		if parts := strings.SplitN(f, ".", 2); len(parts) == 2 && writer.describes[strings.ToLower(parts[0])] != nil {
+			rel := strings.ToLower(parts[0])
+			if children[rel] == nil {
+				children[rel] = newMapRecord()
+			}
+			children[rel].Set(parts[1], value)
+		} else {
+			parent.Set(f, value)
+		}
+	}
+	key := ""
+	if writer.key != "" {
+		if k, ok := parent.Get(writer.key); ok && k != nil {
+			key = String(k)
+		}
+	}
+	if writer.current == nil || key == "" || key != writer.current.key {
+		if err := writer.closeNode(); err != nil {
+			// abort stops the job before the record is reported, other errors are reported by the caller
+			if _, ok := err.(*commons.AbortError); ok {
+				report.Error(fmt.Sprint("not sent: ", err))
+			}
+			return err
+		}
+		writer.current = &treeNode{key: key, ref: writer.nextRef("p"), record: parent}
+	}
+	row := &treeRow{report: report}
+	for _, c := range writer.children {
+		child, ok := children[strings.ToLower(c.Relationship)]
+		if !ok || blank(child) {
+			continue
+		}
+		ref := writer.nextRef("c")
+		row.refs = append(row.refs, ref)
+		writer.current.children = append(writer.current.children, &treeChildRecord{relationship: c.Relationship, ref: ref, record: child})
+	}
+	writer.current.rows = append(writer.current.rows, row)
+	return nil
+}
+
+func blank(record Record) bool {
+	for _, f := range record.Fields() {
+		if v, _ := record.Get(f); v != nil && String(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// closeNode adds current parent with its children to the batch, batch is sent if it would exceed request limits
+func (writer *TreeWriter) closeNode() error {
+	node := writer.current
+	if node == nil {
+		return nil
+	}
+	writer.current = nil
+	size := 1 + len(node.children)
+	if size > MAX_TREE_RECORDS {
+		for _, row := range node.rows {
+			row.report.Error(fmt.Sprint("more than ", MAX_TREE_RECORDS, " records in one tree"))
+		}
+		return nil
+	}
+	if writer.batchRecords+size > MAX_TREE_RECORDS {
+		if err := writer.send(); err != nil {
+			return err
+		}
+	}
+	writer.batch = append(writer.batch, node)
+	writer.batchRecords += size
+	return nil
+}
+
+func (writer *TreeWriter) send() error {
+	batch := writer.batch
+	writer.batch = make([]*treeNode, 0)
+	writer.batchRecords = 0
+	if len(batch) == 0 {
+		return nil
+	}
+	if writer.test {
+		for _, node := range batch {
+			for _, row := range node.rows {
+				row.report.Success(false, "")
+			}
+		}
+		return nil
+	}
+	if err := writer.instance.checkBudget(); err != nil {
+		for _, node := range batch {
+			for _, row := range node.rows {
+				row.report.Error(fmt.Sprint("not sent: ", err))
+			}
+		}
+		return err
+	}
+	records := make([]interface{}, 0, len(batch))
+	sent := 0
+	for _, node := range batch {
+		sent += 1 + len(node.children)
+		parent := jsonRecord(writer.describe, node.record)
+		parent["attributes"] = map[string]interface{}{"type": writer.describe.Name, "referenceId": node.ref}
+		for _, child := range node.children {
+			c := jsonRecord(writer.describes[strings.ToLower(child.relationship)], child.record)
+			c["attributes"] = map[string]interface{}{
+				"type":        writer.describes[strings.ToLower(child.relationship)].Name,
+				"referenceId": child.ref,
+			}
+			related, ok := parent[child.relationship].(map[string]interface{})
+			if !ok {
+				related = map[string]interface{}{"records": make([]interface{}, 0)}
+				parent[child.relationship] = related
+			}
+			related["records"] = append(related["records"].([]interface{}), c)
+		}
+		records = append(records, parent)
+	}
+	var result struct {
+		HasErrors bool `json:"hasErrors"`
+		Results   []struct {
+			ReferenceId string `json:"referenceId"`
+			Id          string `json:"id"`
+			Errors      []struct {
+				StatusCode string   `json:"statusCode"`
+				Message    string   `json:"message"`
+				Fields     []string `json:"fields"`
+			} `json:"errors"`
+		} `json:"results"`
+	}
+	session, err := writer.instance.restSession()
+	if err == nil {
+		_, err = session.rest("POST", "/composite/tree/"+writer.describe.Name, map[string]interface{}{"records": records}, &result)
+	}
+	if err != nil && len(result.Results) == 0 {
+		log.Println(commons.ERRORS, err)
+		panic("error calling salesforce api")
+	}
+	ids := make(map[string]string)
+	errs := make(map[string]string)
+	firstError := ""
+	for _, r := range result.Results {
+		ids[r.ReferenceId] = r.Id
+		if len(r.Errors) > 0 {
+			messages := make([]string, 0, len(r.Errors))
+			for _, e := range r.Errors {
+				messages = append(messages, fmt.Sprint(e.StatusCode, ": ", e.Message, " ", strings.Join(e.Fields, ",")))
+			}
+			errs[r.ReferenceId] = strings.Join(messages, "; ")
+			if firstError == "" {
+				firstError = r.ReferenceId + " " + errs[r.ReferenceId]
+			}
+		}
+	}
+	// failed request without errors of records, or incomplete results, fails all rows of the batch
+	if !result.HasErrors && (err != nil || len(result.Results) != sent) {
+		message := fmt.Sprint("incorrect result returned by salesforce api, expected ", sent, " results, got ", len(result.Results))
+		if err != nil {
+			message = fmt.Sprint("error calling salesforce api: ", err)
+		}
+		for _, node := range batch {
+			for _, row := range node.rows {
+				row.report.Error(message)
+			}
+		}
+		return nil
+	}
+	for _, node := range batch {
+		for _, row := range node.rows {
+			if !result.HasErrors {
+				childIds := make([]string, 0, len(row.refs))
+				for _, ref := range row.refs {
+					childIds = append(childIds, ids[ref])
+				}
+				row.report.Success(true, ids[node.ref], fmt.Sprint("children=", strings.Join(childIds, ",")))
+				continue
+			}
+			message := ""
+			for _, ref := range row.refs {
+				if e, ok := errs[ref]; ok {
+					message = e
+				}
+			}
+			if message == "" {
+				if e, ok := errs[node.ref]; ok {
+					message = "parent: " + e
+				} else {
+					message = "not saved because of error in other record of the request: " + firstError
+				}
+			}
+			row.report.Error(message)
+		}
+	}
+	return nil
+}
+
+func (writer *TreeWriter) Flush() error {
+	if err := writer.closeNode(); err != nil {
+		return err
+	}
+	return writer.send()
+}
+
+func (writer *TreeWriter) Close() error {
+	return writer.Flush()
+}
@@ -0,0 +1,83 @@
+package force
+
+import (
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, rows []map[string]interface{}) []*testReport {
+	tree := &SalesforceTree{Instance: "test", SObject: "Account", Key: "ExtId__c", Children: []*TreeChild{&TreeChild{Relationship: "Contacts", SObject: "Contact"}}}
+	if err := tree.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	fields := []string{"Name", "ExtId__c", "Contacts.LastName", "Contacts.Email"}
+	writer, err := tree.NewWriter(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := make([]*testReport, 0, len(rows))
+	for _, row := range rows {
+		record := writer.NewRecord()
+		for _, f := range fields {
+			if v, ok := row[f]; ok {
+				record.Set(f, v)
+			}
+		}
+		report := &testReport{}
+		reports = append(reports, report)
+		if err := writer.Write(record, report, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return reports
+}
+
+func TestTreeWriter(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	reports := writeTree(t, []map[string]interface{}{
+		{"Name": "Hooli", "ExtId__c": "A5", "Contacts.LastName": "Smith"},
+		{"Name": "Hooli", "ExtId__c": "A5", "Contacts.LastName": "Jones"},
+		{"Name": "Vandelay", "ExtId__c": "A6"},
+	})
+	for _, r := range reports {
+		if !r.success || !r.created {
+			t.Fatal("expected tree saved: ", r.err)
+		}
+	}
+	contacts := server.Records("Contact")
+	if len(contacts) != 2 || contacts[0]["AccountId"] != reports[0].id || reports[0].id != reports[1].id {
+		t.Fatal("expected contacts of one account: ", contacts)
+	}
+	if reports[0].details[0] != "children="+contacts[0]["Id"] || reports[1].details[0] != "children="+contacts[1]["Id"] {
+		t.Fatal("unexpected children of rows: ", reports[0].details, reports[1].details)
+	}
+	if reports[2].details[0] != "children=" || len(server.Records("Account")) != 5 {
+		t.Fatal("expected account without children: ", reports[2].details)
+	}
+}
+
+func TestTreeWriterChildError(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	reports := writeTree(t, []map[string]interface{}{
+		{"Name": "Hooli", "ExtId__c": "A5", "Contacts.LastName": "Smith"},
+		{"Name": "Hooli", "ExtId__c": "A5", "Contacts.Email": "nobody@example.com"},
+		{"Name": "Vandelay", "ExtId__c": "A6", "Contacts.LastName": "Brown"},
+	})
+	// failing child is reported on its source row, other rows are not saved because of it
+	if reports[1].success || !strings.Contains(reports[1].err, "REQUIRED_FIELD_MISSING") {
+		t.Fatal("expected error of the child: ", reports[1].err)
+	}
+	for _, i := range []int{0, 2} {
+		if reports[i].success || !strings.Contains(reports[i].err, "not saved because of error in other record") {
+			t.Fatal("unexpected report of row ", i, ": ", reports[i].err)
+		}
+	}
+	if len(server.Records("Contact")) != 0 || len(server.Records("Account")) != 3 {
+		t.Fatal("expected nothing saved")
+	}
+}
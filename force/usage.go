@@ -0,0 +1,222 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goforce/log"
+	"github.com/goforce/reloader/commons"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_BUDGET_WAIT  int = 300
+	DEFAULT_BUDGET_WAITS int = 12
+)
+
+// sleep is used to pause when budget is exhausted, tests replace it to not wait
+var sleep = time.Sleep
+
+// ApiBudget limits api calls made by reloader on an instance. Calls is max number of calls of the run, Percent is
+// percentage of daily api requests remaining when the run started. When budget is exhausted the run is aborted or,
+// with action pause, waits until remaining daily api requests rise above the share of the budget reserved when the run
+// started, as salesforce frees requests of the rolling 24 hours window. Run is aborted after MaxWaits waits. Pause
+// applies only to percent budget, run is aborted when absolute budget is exhausted.
+type ApiBudget struct {
+	Calls   int     `json:"calls"`
+	Percent float64 `json:"percent"`
+	Action  string  `json:"action"`
+	// seconds to wait before limits are checked again when paused
+	Wait int `json:"wait"`
+	// number of waits before the run is aborted
+	MaxWaits int `json:"maxWaits"`
+}
+
+// apiUsage counts calls made by reloader and keeps daily api requests reported by salesforce
+type apiUsage struct {
+	lock  sync.Mutex
+	calls int
+	used  int
+	max   int
+	// remaining requests not available to the run, set when limits are read for the first time
+	floor int
+	// calls made when remaining requests were read and requests available to the run above the floor
+	base      int
+	available int
+	checked   bool
+}
+
+func (b *ApiBudget) init() error {
+	if b == nil {
+		return nil
+	}
+	b.Action = strings.ToLower(b.Action)
+	if b.Action == "" {
+		b.Action = "abort"
+	}
+	if b.Action != "abort" && b.Action != "pause" {
+		return errors.New(fmt.Sprint("unknown budget action: ", b.Action, ", expected abort or pause"))
+	}
+	if b.Calls < 0 || b.Percent < 0 || b.Percent > 100 {
+		return errors.New("budget calls should be positive and percent between 0 and 100")
+	}
+	if b.Calls == 0 && b.Percent == 0 {
+		return errors.New("either calls or percent of budget should be specified")
+	}
+	if b.Wait <= 0 {
+		b.Wait = DEFAULT_BUDGET_WAIT
+	}
+	if b.MaxWaits <= 0 {
+		b.MaxWaits = DEFAULT_BUDGET_WAITS
+	}
+	return nil
+}
+
+func (u *apiUsage) count() {
+	u.lock.Lock()
+	u.calls++
+	u.lock.Unlock()
+}
+
+// limitInfo reads api usage from Sforce-Limit-Info header of rest responses, like api-usage=25/15000
+func (u *apiUsage) limitInfo(header http.Header) {
+	for _, info := range strings.Split(header.Get("Sforce-Limit-Info"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(info), "=", 2)
+		if len(kv) != 2 || kv[0] != "api-usage" {
+			continue
+		}
+		um := strings.SplitN(kv[1], "/", 2)
+		if len(um) != 2 {
+			continue
+		}
+		used, err1 := strconv.Atoi(um[0])
+		max, err2 := strconv.Atoi(um[1])
+		if err1 == nil && err2 == nil {
+			u.lock.Lock()
+			u.used, u.max = used, max
+			u.lock.Unlock()
+		}
+	}
+}
+
+// readLimits reads daily api requests of the instance using limits resource. Floor of percent budget is set when
+// limits are read for the first time, later reads make available requests above the floor. It returns false if
+// remaining requests are not above the floor.
+func (ins *Instance) readLimits() (bool, error) {
+	s, err := ins.restSession()
+	if err != nil {
+		return false, err
+	}
+	var limits struct {
+		DailyApiRequests struct {
+			Max       int `json:"Max"`
+			Remaining int `json:"Remaining"`
+		} `json:"DailyApiRequests"`
+	}
+	if _, err := s.rest("GET", "/limits", nil, &limits); err != nil {
+		return false, errors.New(fmt.Sprint("error reading limits: ", err))
+	}
+	remaining := limits.DailyApiRequests.Remaining
+	u := &ins.usage
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.max = limits.DailyApiRequests.Max
+	u.used = u.max - remaining
+	if !u.checked {
+		u.floor = remaining - int(float64(remaining)*ins.Budget.Percent/100)
+		u.checked = true
+	}
+	if remaining <= u.floor {
+		return false, nil
+	}
+	u.base = u.calls
+	u.available = remaining - u.floor
+	return true, nil
+}
+
+// allowed returns number of calls allowed by budget
+func (ins *Instance) allowed() int {
+	u := &ins.usage
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	allowed := -1
+	if ins.Budget.Percent > 0 {
+		allowed = u.base + u.available
+	}
+	if ins.Budget.Calls > 0 && (allowed < 0 || ins.Budget.Calls < allowed) {
+		allowed = ins.Budget.Calls
+	}
+	return allowed
+}
+
+// checkBudget is called before a batch is sent, it returns abort error if budget is exhausted or pauses until
+// api requests are available.
+func (ins *Instance) checkBudget() error {
+	if ins.Budget == nil {
+		return nil
+	}
+	u := &ins.usage
+	u.lock.Lock()
+	checked := u.checked
+	u.lock.Unlock()
+	if !checked && ins.Budget.Percent > 0 {
+		if _, err := ins.readLimits(); err != nil {
+			return &commons.AbortError{Message: err.Error()}
+		}
+	}
+	waits := 0
+	for {
+		allowed := ins.allowed()
+		u.lock.Lock()
+		calls := u.calls
+		u.lock.Unlock()
+		if calls < allowed {
+			return nil
+		}
+		if ins.Budget.Action != "pause" || ins.Budget.Percent == 0 || ins.Budget.Calls > 0 && calls >= ins.Budget.Calls {
+			return &commons.AbortError{Message: fmt.Sprint("api budget exceeded: ", calls, " calls made, ", allowed, " allowed")}
+		}
+		for resumed := false; !resumed; {
+			if waits >= ins.Budget.MaxWaits {
+				return &commons.AbortError{Message: fmt.Sprint("api budget exceeded: ", calls, " calls made, no api requests freed after ", waits, " waits")}
+			}
+			waits++
+			log.Println(commons.PROGRESS, "api budget exhausted, ", calls, " calls made, waiting ", ins.Budget.Wait, " seconds")
+			sleep(time.Duration(ins.Budget.Wait) * time.Second)
+			var err error
+			if resumed, err = ins.readLimits(); err != nil {
+				return &commons.AbortError{Message: err.Error()}
+			}
+		}
+	}
+}
+
+// UsageSummary returns api usage of instances used by reloader
+func UsageSummary() []string {
+	if salesforce == nil {
+		return nil
+	}
+	names := make([]string, 0, len(salesforce.Instances))
+	for name := range salesforce.Instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summary := make([]string, 0)
+	for _, name := range names {
+		u := &salesforce.Instances[name].usage
+		u.lock.Lock()
+		if u.calls > 0 {
+			line := fmt.Sprint("instance ", name, ": ", u.calls, " api calls")
+			if u.max > 0 {
+				line += fmt.Sprint(", daily api requests used ", u.used, " of ", u.max)
+			}
+			summary = append(summary, line)
+		}
+		u.lock.Unlock()
+	}
+	return summary
+}
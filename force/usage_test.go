@@ -0,0 +1,178 @@
+package force
+
+import (
+	"github.com/goforce/reloader/commons"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudgetAbort(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	salesforce.Instances["test"].Budget = &ApiBudget{Calls: 3}
+	if err := salesforce.Instances["test"].Budget.init(); err != nil {
+		t.Fatal(err)
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT", BatchSize: 1}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"LastName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var abort error
+	reports := make([]*testReport, 0)
+	for i := 0; i < 4 && abort == nil; i++ {
+		record := writer.NewRecord()
+		record.Set("LastName", "Smith")
+		report := &testReport{}
+		reports = append(reports, report)
+		abort = writer.Write(record, report, nil)
+	}
+	writer.Close()
+	if _, ok := abort.(*commons.AbortError); !ok {
+		t.Fatal("expected abort error, got: ", abort)
+	}
+	// describe and two batches are within budget
+	if len(reports) != 3 || !reports[1].success || !strings.Contains(reports[2].err, "budget") {
+		t.Fatal("unexpected reports: ", len(reports), reports[2].err)
+	}
+	if server.Calls("create") != 2 {
+		t.Fatal("expected two batches sent, got: ", server.Calls("create"))
+	}
+	if summary := UsageSummary(); len(summary) != 1 || !strings.Contains(summary[0], "3 api calls") {
+		t.Fatal("unexpected summary: ", summary)
+	}
+}
+
+func TestBudgetAbortDeferred(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	salesforce.Instances["test"].Budget = &ApiBudget{Calls: 3}
+	if err := salesforce.Instances["test"].Budget.init(); err != nil {
+		t.Fatal(err)
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT", BatchSize: 1, DeferredFields: []string{"Email"}, DeferredKey: "LastName"}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"LastName", "Email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var abort error
+	reports := make([]*testReport, 0)
+	for i := 0; i < 4 && abort == nil; i++ {
+		record := writer.NewRecord()
+		record.Set("LastName", "Smith")
+		record.Set("Email", "smith@example.com")
+		report := &testReport{}
+		reports = append(reports, report)
+		abort = writer.Write(record, report, nil)
+	}
+	writer.Close()
+	if _, ok := abort.(*commons.AbortError); !ok {
+		t.Fatal("expected abort error, got: ", abort)
+	}
+	// records written in the first pass are not updated after abort
+	if len(reports) != 3 || !strings.Contains(reports[0].err, "job aborted") || !strings.Contains(reports[1].err, "job aborted") {
+		t.Fatal("unexpected reports: ", len(reports), reports[0].err)
+	}
+	if server.Calls("update") != 0 {
+		t.Fatal("expected no second pass after abort")
+	}
+}
+
+func TestBudgetPercent(t *testing.T) {
+	server := newApiTestServer(t, "rest")
+	defer server.Close()
+	server.DailyApiRequests = 100
+	instance := salesforce.Instances["test"]
+	instance.Budget = &ApiBudget{Percent: 5}
+	if err := instance.Budget.init(); err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]map[string]interface{}, 0)
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]interface{}{"LastName": "Smith"})
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT", BatchSize: 1}
+	reports := write(t, target, []string{"LastName"}, rows)
+	sent := 0
+	for _, r := range reports {
+		if r.success {
+			sent++
+		}
+	}
+	// five percent of remaining requests, describe is the first one
+	if sent == 0 || sent >= 5 {
+		t.Fatal("unexpected number of records sent: ", sent)
+	}
+	if instance.usage.max != 100 || instance.usage.used == 0 {
+		t.Fatal("expected limits read: ", instance.usage.used, "/", instance.usage.max)
+	}
+}
+
+func TestLimitInfo(t *testing.T) {
+	var u apiUsage
+	header := make(http.Header)
+	header.Set("Sforce-Limit-Info", "api-usage=25/15000, per-app-api-usage=1/100(appName=x)")
+	u.limitInfo(header)
+	if u.used != 25 || u.max != 15000 {
+		t.Fatal("unexpected usage: ", u.used, "/", u.max)
+	}
+}
+
+func TestBudgetPause(t *testing.T) {
+	server := newApiTestServer(t, "rest")
+	defer server.Close()
+	server.DailyApiRequests = 100
+	instance := salesforce.Instances["test"]
+	instance.Budget = &ApiBudget{Percent: 5, Action: "pause", MaxWaits: 5}
+	if err := instance.Budget.init(); err != nil {
+		t.Fatal(err)
+	}
+	// requests are freed by salesforce only on every third wait
+	waits := 0
+	sleep = func(time.Duration) {
+		waits++
+		if waits%3 == 0 {
+			server.ApiRequests = 0
+		}
+	}
+	defer func() { sleep = time.Sleep }()
+	rows := make([]map[string]interface{}, 0)
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]interface{}{"LastName": "Smith"})
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT", BatchSize: 1}
+	for _, r := range write(t, target, []string{"LastName"}, rows) {
+		if !r.success {
+			t.Fatal("expected all records sent: ", r.err)
+		}
+	}
+	// job keeps waiting while remaining requests are below the floor
+	if waits == 0 || waits%3 != 0 {
+		t.Fatal("unexpected number of waits: ", waits)
+	}
+	// no requests freed, job is aborted after max waits
+	waits = 0
+	sleep = func(time.Duration) { waits++ }
+	writer, err := target.NewWriter([]string{"LastName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var abort error
+	for i := 0; i < 10 && abort == nil; i++ {
+		record := writer.NewRecord()
+		record.Set("LastName", "Smith")
+		abort = writer.Write(record, &testReport{}, nil)
+	}
+	writer.Close()
+	if _, ok := abort.(*commons.AbortError); !ok || waits != 5 {
+		t.Fatal("expected abort after 5 waits, got: ", waits, abort)
+	}
+}
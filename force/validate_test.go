@@ -0,0 +1,39 @@
+package force
+
+import (
+	. "github.com/goforce/api/commons"
+	"testing"
+)
+
+func TestValidateRecord(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	instance := salesforce.Instances["test"]
+	if err := instance.connect(); err != nil {
+		t.Fatal(err)
+	}
+	describe, err := instance.connection.DescribeSObject("Account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := NewDescribedRecord(describe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("Name", "Acme")
+	record.Set("Type", "partner")
+	if errs := validateRecord(describe, record); len(errs) != 0 {
+		t.Fatal("unexpected errors: ", errs)
+	}
+	if mustGet(t, record, "Type") != "Partner" {
+		t.Fatal("expected picklist value corrected")
+	}
+	record.Set("Type", "Vendor")
+	if errs := validateRecord(describe, record); len(errs) != 1 {
+		t.Fatal("expected missing picklist value error")
+	}
+	record.Set("Type", "")
+	if errs := validateRecord(describe, record); len(errs) != 0 {
+		t.Fatal("unexpected errors: ", errs)
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/goforce/api/commons"
-	"github.com/goforce/api/soap"
 	"github.com/goforce/eval"
 	"github.com/goforce/log"
 	"github.com/goforce/reloader/commons"
 	"strings"
+	"time"
 )
 
 const (
@@ -16,9 +16,14 @@ const (
 	MAX_NUM_WORKERS int = 5
 )
 
+// operations creating new records or events if sent twice, or failing for records already processed by the first try,
+// like ENTITY_IS_DELETED of delete or UNDELETE_FAILED of undelete resent after a timed out call which was committed
+var unrepeatableOperations = []string{"INSERT", "PUBLISH", "MERGE", "CONVERTLEAD", "DELETE", "UNDELETE", "HARDDELETE", "EMPTYRECYCLEBIN"}
+
 type batchWork struct {
 	records []Record
 	reports []commons.Report
+	bytes   int
 }
 
 type ForceWriter struct {
@@ -31,7 +36,16 @@ type ForceWriter struct {
 	workers         chan *batchWork
 	nestedFields    map[string]*DescribeSObjectResult
 	fields          []string
+	topFields       []string
+	flags           commons.Flags
+	onlyChanged     bool
+	adaptive        *adaptiveSizer
+	binary          bool
+	maxFileSize     int64
+	deferred        *deferredPass
 	test            bool
+	// set when api budget is exhausted, no more calls are made by the writer
+	aborted bool
 }
 
 func (target *SalesforceTarget) NewWriter(fields []string) (commons.Writer, error) {
@@ -43,14 +57,23 @@ func (target *SalesforceTarget) NewWriter(fields []string) (commons.Writer, erro
 	if batchSize == 0 {
 		batchSize = salesforce.BatchSize
 	}
-	if batchSize <= 0 || batchSize > MAX_BATCH_SIZE {
-		batchSize = MAX_BATCH_SIZE
+	// operation limits size of batches, adaptive mode does not grow batches above it
+	maxBatchSize := MAX_BATCH_SIZE
+	if strings.ToUpper(target.Operation) == "CONVERTLEAD" {
+		maxBatchSize = MAX_CONVERT_BATCH_SIZE
+	}
+	if batchSize <= 0 || batchSize > maxBatchSize {
+		batchSize = maxBatchSize
+	}
+	maxWorkers := MAX_NUM_WORKERS
+	if target.Adaptive && target.MaxWorkers > 0 {
+		maxWorkers = target.MaxWorkers
 	}
 	numWorkers := target.Workers
 	if numWorkers <= 0 {
 		numWorkers = 1
-	} else if numWorkers > MAX_NUM_WORKERS {
-		numWorkers = MAX_NUM_WORKERS
+	} else if numWorkers > maxWorkers {
+		numWorkers = maxWorkers
 	}
 	writer := &ForceWriter{
 		instance:     target.instance,
@@ -60,6 +83,23 @@ func (target *SalesforceTarget) NewWriter(fields []string) (commons.Writer, erro
 		workers:      make(chan *batchWork, numWorkers),
 		nestedFields: make(map[string]*DescribeSObjectResult),
 		fields:       fields,
+		topFields:    topLevelFields(fields),
+		onlyChanged:  target.OnlyChanged,
+		maxFileSize:  target.MaxFileSize,
+	}
+	if writer.maxFileSize <= 0 {
+		writer.maxFileSize = MAX_FILE_SIZE
+	}
+	if len(target.DeferredFields) > 0 {
+		key := target.DeferredKey
+		if key == "" {
+			key = target.ExternalId
+		}
+		writer.deferred = newDeferredPass(target.DeferredFields, key)
+	}
+	if target.Adaptive {
+		writer.adaptive = newAdaptiveSizer(batchSize, maxBatchSize, numWorkers, maxWorkers)
+		writer.workers = make(chan *batchWork, maxWorkers)
 	}
 	// init workers
 	for i := 0; i < numWorkers; i++ {
@@ -69,32 +109,22 @@ func (target *SalesforceTarget) NewWriter(fields []string) (commons.Writer, erro
 	if err != nil {
 		return nil, errors.New(fmt.Sprint("not able to connect to target instance: ", target.Instance, "\n", err))
 	}
+	if writer.operation == "CONVERTLEAD" {
+		if err := validateConvertFields(fields); err != nil {
+			return nil, err
+		}
+	}
 	if target.SObject != "" {
 		writer.sObjectDescribe, err = target.instance.connection.DescribeSObject(target.SObject)
 		if err != nil {
 			return nil, errors.New(fmt.Sprint("error describing SObject: ", target.SObject, "\n", err))
 		}
 		for _, f := range fields {
-			fp := strings.Split(f, ".")
-			if len(fp) > 1 {
-				var fieldName string
-				var referenceTo string
-				ts := strings.Split(fp[0], ":")
-				if len(ts) > 1 {
-					fieldName = ts[0]
-					referenceTo = ts[1]
-				} else {
-					fieldName = ts[0]
-					if relfd := writer.sObjectDescribe.GetRelationship(fieldName); relfd == nil {
-						return nil, errors.New(fmt.Sprint("no relationship: ", fieldName, " in: ", target.SObject))
-					} else {
-						if len(relfd.ReferenceTo) > 0 {
-							referenceTo = relfd.ReferenceTo[0]
-						} else {
-							return nil, errors.New(fmt.Sprint("no relationship: ", fieldName, " in: ", target.SObject))
-						}
-					}
-				}
+			fieldName, referenceTo, err := nestedReference(writer.sObjectDescribe, f)
+			if err != nil {
+				return nil, err
+			}
+			if referenceTo != "" {
 				rede, err := target.instance.connection.DescribeSObject(referenceTo)
 				if err != nil {
 					return nil, errors.New(fmt.Sprint("error describing SObject: ", referenceTo, "\n", err))
@@ -106,6 +136,31 @@ func (target *SalesforceTarget) NewWriter(fields []string) (commons.Writer, erro
 	return writer, nil
 }
 
+// nestedReference returns relationship name and referenced object for nested fields like Account:Account.ExtId__c or
+// Account.ExtId__c, for other fields referenced object is empty.
+func nestedReference(describe *DescribeSObjectResult, f string) (fieldName string, referenceTo string, err error) {
+	fp := strings.Split(f, ".")
+	if len(fp) > 1 {
+		ts := strings.Split(fp[0], ":")
+		if len(ts) > 1 {
+			fieldName = ts[0]
+			referenceTo = ts[1]
+		} else {
+			fieldName = ts[0]
+			if relfd := describe.GetRelationship(fieldName); relfd == nil {
+				return "", "", errors.New(fmt.Sprint("no relationship: ", fieldName, " in: ", describe.Name))
+			} else {
+				if len(relfd.ReferenceTo) > 0 {
+					referenceTo = relfd.ReferenceTo[0]
+				} else {
+					return "", "", errors.New(fmt.Sprint("no relationship: ", fieldName, " in: ", describe.Name))
+				}
+			}
+		}
+	}
+	return fieldName, referenceTo, nil
+}
+
 func (writer *ForceWriter) SetTest(test bool) {
 	writer.test = test
 }
@@ -115,6 +170,10 @@ func (writer *ForceWriter) Fields() []string {
 }
 
 func (writer *ForceWriter) NewRecord() commons.Record {
+	// arguments of lead conversion are not fields of the lead
+	if writer.operation == "CONVERTLEAD" {
+		return newMapRecord()
+	}
 	r, err := NewDescribedRecord(writer.sObjectDescribe)
 	for fieldName, describe := range writer.nestedFields {
 		nested, err := NewDescribedRecord(describe)
@@ -126,6 +185,9 @@ func (writer *ForceWriter) NewRecord() commons.Record {
 	if err != nil {
 		panic(err)
 	}
+	if writer.operation == "MERGE" {
+		return &mergeRecord{Record: r}
+	}
 	return r
 }
 
@@ -133,6 +195,33 @@ func (writer *ForceWriter) Write(record commons.Record, report commons.Report, c
 	// pull data for copy operation
 	if writer.operation == "COPY" {
 
+	}
+	// ids of merged records are kept aside, flags could replace the record
+	var merged *mergeRecord
+	if writer.operation == "MERGE" {
+		merged = record.(*mergeRecord)
+		record = merged.Record
+	}
+	// normalize values according to the flags
+	flagged, err := writer.applyFlags(record.(Record))
+	if err != nil {
+		report.Output(record)
+		return err
+	}
+	record = flagged
+	if merged != nil {
+		merged.Record = flagged
+		record = merged
+		if _, err := merged.mergeIds(); err != nil {
+			report.Output(record)
+			return err
+		}
+	}
+	if writer.operation == "CONVERTLEAD" {
+		if err := validateConvert(record.(Record)); err != nil {
+			report.Output(record)
+			return err
+		}
 	}
 	// validate all values
 	errs := validateRecord(writer.sObjectDescribe, record.(Record))
@@ -144,6 +233,37 @@ func (writer *ForceWriter) Write(record commons.Record, report commons.Report, c
 		}
 		return errors.New(s)
 	}
+	// read content of files
+	size := 0
+	if writer.binary {
+		var details []string
+		size, details, err = writer.loadFiles(record.(Record))
+		if err != nil {
+			return err
+		}
+		if len(details) > 0 {
+			report = &detailedReport{Report: report, details: details}
+		}
+		// keep binary batches within request size limits
+		if writer.batch != nil && len(writer.batch.records) > 0 && writer.batch.bytes+size > MAX_BINARY_BATCH_BYTES {
+			if err := writer.Flush(); err != nil {
+				// abort stops the job before the record is reported, other errors are reported by the caller
+				if _, ok := err.(*commons.AbortError); ok {
+					report.Error(fmt.Sprint("not sent: ", err))
+				}
+				return err
+			}
+		}
+	}
+	// leave deferred fields for the second pass
+	if writer.deferred != nil && !writer.test {
+		var stripped Record
+		stripped, report, err = writer.deferValues(record.(Record), report)
+		if err != nil {
+			return err
+		}
+		record = stripped
+	}
 	if writer.batch == nil {
 		writer.batch = <-writer.workers
 	}
@@ -152,8 +272,9 @@ func (writer *ForceWriter) Write(record commons.Record, report commons.Report, c
 	} else {
 		writer.batch.records = append(writer.batch.records, record.(Record))
 		writer.batch.reports = append(writer.batch.reports, report)
+		writer.batch.bytes += size
 	}
-	if len(writer.batch.records) == cap(writer.batch.records) {
+	if len(writer.batch.records) >= writer.currentBatchSize() {
 		return writer.Flush()
 	}
 	return nil
@@ -165,59 +286,180 @@ func (writer *ForceWriter) Flush() error {
 	}
 	batch := writer.batch
 	writer.batch = nil
+	if len(batch.records) > 0 && !writer.test {
+		if err := writer.instance.checkBudget(); err != nil {
+			writer.aborted = true
+			for _, report := range batch.reports {
+				report.Error(fmt.Sprint("not sent: ", err))
+			}
+			batch.records = make([]Record, 0, writer.batchSize)
+			batch.reports = make([]commons.Report, 0, writer.batchSize)
+			batch.bytes = 0
+			writer.returnWorker(batch)
+			return err
+		}
+	}
 	go func() {
 		if len(batch.records) > 0 {
-			// write batch
-			var results []soap.DmlResult
-			var err error
-			if writer.operation == "UPSERT" {
-				results, err = writer.instance.connection.Upsert(batch.records, writer.externalId)
-			} else if writer.operation == "UPDATE" {
-				results, err = writer.instance.connection.Update(batch.records)
-			} else if writer.operation == "INSERT" {
-				results, err = writer.instance.connection.Insert(batch.records)
-			} else if writer.operation == "DELETE" {
-				results, err = writer.instance.connection.Delete(batch.records)
-			} else if writer.operation == " COPY" {
-				results, err = writer.instance.connection.Insert(batch.records)
-			} else {
-				panic(fmt.Sprint("unknown operation:", writer.operation))
-			}
-			if err != nil {
-				log.Println(commons.ERRORS, err)
-				panic("error calling salesforce api")
-			}
-			if len(batch.records) != len(results) {
-				log.Println(commons.ERRORS, results)
-				panic("incorrect result returned salesforce api")
-			}
-			for i, report := range batch.reports {
-				result := results[i]
-				if result.Success {
-					report.Success(result.Created, result.Id)
-				} else {
-					report.Error(result.Errors.Message)
-				}
-			}
+			writer.send(batch)
 			// empty batch
 			batch.records = make([]Record, 0, writer.batchSize)
 			batch.reports = make([]commons.Report, 0, writer.batchSize)
+			batch.bytes = 0
 		}
 		// return worker
-		writer.workers <- batch
+		writer.returnWorker(batch)
 	}()
 	return nil
 }
 
+func (writer *ForceWriter) currentBatchSize() int {
+	batchSize := writer.batchSize
+	if writer.adaptive != nil {
+		batchSize = writer.adaptive.size()
+	}
+	if writer.binary && batchSize > MAX_BINARY_BATCH_SIZE {
+		batchSize = MAX_BINARY_BATCH_SIZE
+	}
+	return batchSize
+}
+
+func (writer *ForceWriter) returnWorker(batch *batchWork) {
+	if writer.adaptive != nil {
+		writer.adaptive.returnWorker(writer.workers, batch)
+	} else {
+		writer.workers <- batch
+	}
+}
+
+func (writer *ForceWriter) send(batch *batchWork) {
+	records, reports := batch.records, batch.reports
+	if writer.onlyChanged {
+		records, reports = writer.removeUnchanged(records, reports)
+	} else {
+		records, reports = writer.removeInsertOnly(records, reports)
+	}
+	if len(records) == 0 {
+		return
+	}
+	writer.sendRecords(records, reports)
+}
+
+func (writer *ForceWriter) sendRecords(records []Record, reports []commons.Report) {
+	startTime := time.Now()
+	results, err := writer.dml(records)
+	if err != nil {
+		if writer.adaptive != nil && isTimeout(err) {
+			writer.adaptive.shrink("timeout")
+			// repeat only operations which are safe to be sent twice
+			if len(records) > 1 && !commons.ContainsFold(unrepeatableOperations, writer.operation) {
+				half := len(records) / 2
+				writer.sendRecords(records[:half], reports[:half])
+				writer.sendRecords(records[half:], reports[half:])
+				return
+			}
+			for _, report := range reports {
+				report.Error(fmt.Sprint("timeout calling salesforce api: ", err))
+			}
+			return
+		}
+		log.Println(commons.ERRORS, err)
+		panic("error calling salesforce api")
+	}
+	if len(records) != len(results) {
+		log.Println(commons.ERRORS, results)
+		panic("incorrect result returned salesforce api")
+	}
+	retry := make([]int, 0)
+	if writer.adaptive != nil {
+		for i, result := range results {
+			if !result.Success && isCpuTimeLimit(result.Message) {
+				retry = append(retry, i)
+			}
+		}
+		if len(retry) > 0 {
+			writer.adaptive.shrink("CPU time limit")
+		} else if time.Since(startTime) < FAST_BATCH_DURATION {
+			writer.adaptive.grow(len(records))
+		}
+	}
+	if len(retry) > 0 && len(records) > 1 {
+		// failed records were rolled back, send them again in smaller batches
+		retryRecords := make([]Record, len(retry))
+		retryReports := make([]commons.Report, len(retry))
+		for i, j := range retry {
+			retryRecords[i] = records[j]
+			retryReports[i] = reports[j]
+			reports[j] = nil
+		}
+		half := (len(retry) + 1) / 2
+		writer.sendRecords(retryRecords[:half], retryReports[:half])
+		if half < len(retry) {
+			writer.sendRecords(retryRecords[half:], retryReports[half:])
+		}
+	}
+	for i, report := range reports {
+		if report == nil {
+			continue
+		}
+		result := results[i]
+		if result.Success {
+			report.Success(result.Created, result.Id, result.Details...)
+		} else {
+			report.Error(result.Message)
+		}
+	}
+}
+
+func (writer *ForceWriter) dml(records []Record) (results []DmlResult, err error) {
+	sObject := writer.sObjectDescribe.Name
+	if writer.operation == "UPSERT" {
+		results, err = writer.instance.connection.Upsert(sObject, records, writer.externalId)
+	} else if writer.operation == "UPDATE" {
+		results, err = writer.instance.connection.Update(sObject, records)
+	} else if writer.operation == "INSERT" || writer.operation == "PUBLISH" {
+		// platform events are published by inserting them
+		results, err = writer.instance.connection.Insert(sObject, records)
+	} else if writer.operation == "DELETE" {
+		results, err = writer.instance.connection.Delete(records)
+	} else if writer.operation == "HARDDELETE" {
+		results, err = writer.hardDelete(records)
+	} else if writer.operation == "UNDELETE" {
+		results, err = writer.recycle("undelete", recordIds(records))
+	} else if writer.operation == "EMPTYRECYCLEBIN" {
+		results, err = writer.recycle("emptyRecycleBin", recordIds(records))
+	} else if writer.operation == "MERGE" {
+		results, err = writer.merge(records)
+	} else if writer.operation == "CONVERTLEAD" {
+		results, err = writer.convertLeads(records)
+	} else if writer.operation == " COPY" {
+		results, err = writer.instance.connection.Insert(sObject, records)
+	} else {
+		panic(fmt.Sprint("unknown operation:", writer.operation))
+	}
+	return
+}
+
 func (writer *ForceWriter) Close() error {
 	if writer.workers == nil {
 		return nil
 	}
 	writer.Flush()
 	// wait all workers have finished
-	for i := cap(writer.workers); i > 0; i-- {
-		<-writer.workers
+	if writer.adaptive != nil {
+		writer.adaptive.waitWorkers(writer.workers)
+	} else {
+		for i := cap(writer.workers); i > 0; i-- {
+			<-writer.workers
+		}
 	}
 	writer.workers = nil
+	if writer.deferred != nil && writer.aborted {
+		writer.deferred.fail(writer.deferred.updates, "job aborted")
+		return nil
+	}
+	if writer.deferred != nil && !writer.test {
+		return writer.secondPass()
+	}
 	return nil
 }
@@ -0,0 +1,158 @@
+package force
+
+import (
+	"strings"
+	"testing"
+)
+
+// write writes values through salesforce target and returns reports of all records
+func write(t *testing.T, target *SalesforceTarget, fields []string, rows []map[string]interface{}) []*testReport {
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := make([]*testReport, 0, len(rows))
+	for _, row := range rows {
+		record := writer.NewRecord()
+		for _, f := range fields {
+			if v, ok := row[f]; ok {
+				if _, err := record.Set(f, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		report := &testReport{}
+		reports = append(reports, report)
+		if err := writer.Write(record, report, nil); err != nil {
+			report.Error(err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return reports
+}
+
+func writeContacts(t *testing.T, operation string, rows []map[string]interface{}) []*testReport {
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: operation}
+	return write(t, target, []string{"LastName", "Email", "Account:Account.ExtId__c"}, rows)
+}
+
+func TestWriterInsert(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	reports := writeContacts(t, "INSERT", []map[string]interface{}{
+		{"LastName": "Smith", "Email": "smith@example.com", "Account:Account.ExtId__c": "A1"},
+		{"LastName": "Jones", "Account:Account.ExtId__c": "A9"},
+		{"Email": "nobody@example.com"},
+	})
+	if !reports[0].success || !reports[0].created || reports[0].id == "" {
+		t.Fatal("expected record inserted: ", reports[0].err)
+	}
+	if reports[1].success || !strings.Contains(reports[1].err, "A9") {
+		t.Fatal("expected error of missing account: ", reports[1].err)
+	}
+	if reports[2].success || !strings.Contains(reports[2].err, "LastName") {
+		t.Fatal("expected error of required field: ", reports[2].err)
+	}
+	contacts := server.Records("Contact")
+	if len(contacts) != 1 || contacts[0]["AccountId"] != server.Records("Account")[0]["Id"] {
+		t.Fatal("unexpected contacts: ", contacts)
+	}
+}
+
+func TestWriterBatches(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	rows := make([]map[string]interface{}, 0)
+	for i := 0; i < 5; i++ {
+		rows = append(rows, map[string]interface{}{"LastName": "Smith"})
+	}
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT", BatchSize: 2, Workers: 2}
+	reports := write(t, target, []string{"LastName"}, rows)
+	for _, r := range reports {
+		if !r.success {
+			t.Fatal("expected record inserted: ", r.err)
+		}
+	}
+	if server.Calls("create") != 3 || len(server.Records("Contact")) != 5 {
+		t.Fatal("expected 3 batches, got: ", server.Calls("create"))
+	}
+}
+
+func TestWriterUpsertUpdateDelete(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UPSERT", ExternalId: "ExtId__c"}
+	reports := write(t, target, []string{"ExtId__c", "Name"}, []map[string]interface{}{
+		{"ExtId__c": "A1", "Name": "Acme Corp"},
+		{"ExtId__c": "A4", "Name": "Hooli"},
+	})
+	if !reports[0].success || reports[0].created || !reports[1].success || !reports[1].created {
+		t.Fatal("expected update and insert: ", reports[0].err, reports[1].err)
+	}
+	if findRecord(server.Records("Account"), "ExtId__c", "A1")["Name"] != "Acme Corp" {
+		t.Fatal("expected account updated")
+	}
+	id := reports[1].id
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "UPDATE"}
+	reports = write(t, target, []string{"Id", "Type"}, []map[string]interface{}{{"Id": id, "Type": "Partner"}})
+	if !reports[0].success || findRecord(server.Records("Account"), "Id", id)["Type"] != "Partner" {
+		t.Fatal("expected account updated: ", reports[0].err)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "DELETE"}
+	reports = write(t, target, []string{"Id"}, []map[string]interface{}{{"Id": id}})
+	if !reports[0].success || findRecord(server.Records("Account"), "Id", id) != nil {
+		t.Fatal("expected account deleted: ", reports[0].err)
+	}
+}
+
+func TestWriterTest(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Contact", Operation: "INSERT"}
+	if err := target.Init(noresolve); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := target.NewWriter([]string{"LastName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.SetTest(true)
+	record := writer.NewRecord()
+	record.Set("LastName", "Smith")
+	report := &testReport{}
+	if err := writer.Write(record, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	if !report.success || server.Calls("create") != 0 {
+		t.Fatal("expected nothing written in test mode")
+	}
+}
+
+func TestWriterPublish(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	target := &SalesforceTarget{Instance: "test", SObject: "Order_Placed__e", Operation: "PUBLISH"}
+	reports := write(t, target, []string{"OrderNumber__c", "Amount__c"}, []map[string]interface{}{
+		{"OrderNumber__c": "O-1", "Amount__c": "12.5"},
+		{"Amount__c": "3"},
+	})
+	if !reports[0].success || !strings.HasPrefix(reports[0].id, "e00") {
+		t.Fatal("expected event published: ", reports[0].err)
+	}
+	if reports[1].success || !strings.Contains(reports[1].err, "OrderNumber__c") {
+		t.Fatal("expected error of missing field: ", reports[1].err)
+	}
+	if events := server.Records("Order_Placed__e"); len(events) != 1 || events[0]["Amount__c"] != "12.5" {
+		t.Fatal("unexpected events: ", events)
+	}
+	target = &SalesforceTarget{Instance: "test", SObject: "Account", Operation: "PUBLISH"}
+	if err := target.Init(noresolve); err == nil {
+		t.Fatal("expected error of publishing not an event")
+	}
+}
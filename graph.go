@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"github.com/goforce/reloader/csv"
+	"github.com/goforce/reloader/force"
+)
+
+// graphJobs creates upsert jobs loading exported graph files in the order of references between objects.
+func (config *Config) graphJobs() ([]*Job, error) {
+	if config.Graph == nil {
+		return nil, errors.New("graph should be configured")
+	}
+	plan, err := config.Graph.ImportPlan()
+	if err != nil {
+		return nil, err
+	}
+	noresolve := func(name string) string { return name }
+	jobs := make([]*Job, 0, len(plan))
+	for _, o := range plan {
+		header, err := force.ReadCsvHeader(o.Path)
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{Label: "graph-" + o.SObject}
+		job.Source.Csv = &csv.CsvSource{Path: o.Path}
+		job.Target.Salesforce = &force.SalesforceTarget{
+			Instance:   o.Instance,
+			SObject:    o.SObject,
+			Operation:  "UPSERT",
+			ExternalId: o.Key,
+		}
+		for _, column := range header {
+			rule := &Rule{Source: column, Target: column}
+			if err := rule.parseExpressionsAndFlags(); err != nil {
+				return nil, err
+			}
+			job.Rules = append(job.Rules, rule)
+		}
+		if err := job.Source.Csv.Init(noresolve); err != nil {
+			return nil, err
+		}
+		if err := job.Target.Salesforce.Init(noresolve); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
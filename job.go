@@ -7,22 +7,43 @@ import (
 	"github.com/goforce/eval"
 	"github.com/goforce/log"
 	"github.com/goforce/reloader/commons"
+	"github.com/goforce/reloader/force"
 	"github.com/goforce/reloader/report"
 	"io"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
+// READ_AHEAD is number of records per transformer which could be read ahead of the record being written
+const READ_AHEAD int = 16
+
+// firstCall matches calls of FIRST function, its result depends on the order records are evaluated in
+var firstCall = regexp.MustCompile(`(?i)\bFIRST\s*\(`)
+
 type Globals struct {
 	test      bool
 	values    eval.Values
 	functions eval.Functions
+	mappings  map[string]*Mapping
+}
+
+// jobReport is report of one source record, records could also be reported as violating checks
+type jobReport interface {
+	commons.Report
+	Violation(check string, severity string, message string)
 }
 
 func (job *Job) Execute(globals *Globals) (err error) {
 
 	startTime := time.Now()
-	defer func() { log.Println(commons.PROGRESS, " job completed in ", time.Since(startTime)) }()
+	defer func() {
+		log.Println(commons.PROGRESS, " job completed in ", time.Since(startTime))
+		for _, usage := range force.UsageSummary() {
+			log.Println(commons.PROGRESS, usage)
+		}
+	}()
 	log.Println(commons.PROGRESS, "starting job", job.Label)
 
 	var reporter report.Reporter
@@ -53,6 +74,10 @@ func (job *Job) Execute(globals *Globals) (err error) {
 		target = job.Target.Salesforce
 	} else if job.Target.Csv != nil {
 		target = job.Target.Csv
+	} else if job.Target.Tree != nil {
+		target = job.Target.Tree
+	} else if job.Target.Endpoint != nil {
+		target = job.Target.Endpoint
 	}
 
 	var targetFields = make([]string, 0, len(job.Rules))
@@ -77,18 +102,32 @@ func (job *Job) Execute(globals *Globals) (err error) {
 		return errors.New(fmt.Sprint("error opening source reader in job ", job.Label, " :", err))
 	}
 
-	targetWriter, err = target.NewWriter(targetFields)
-	if err != nil {
-		return errors.New(fmt.Sprint("error opening target writer in job ", job.Label, " :", err))
-	}
-	if usesFlags, ok := targetWriter.(commons.UsesFlags); ok {
-		usesFlags.SetFlags(flags)
+	// jobs without target only evaluate checks against source records
+	var valuesSupplier eval.Values
+	var targetFunctions eval.Functions
+	var writtenFields []string
+	if target != nil {
+		targetWriter, err = target.NewWriter(targetFields)
+		if err != nil {
+			return errors.New(fmt.Sprint("error opening target writer in job ", job.Label, " :", err))
+		}
+		if usesFlags, ok := targetWriter.(commons.UsesFlags); ok {
+			usesFlags.SetFlags(flags)
+		}
+		// precheck after flags are set, flags change which fields are written by each operation
+		if prechecker, ok := targetWriter.(commons.Prechecker); ok {
+			if err = prechecker.Precheck(); err != nil {
+				return errors.New(fmt.Sprint("precheck of target failed in job ", job.Label, ":\n", err))
+			}
+		}
+		targetWriter.SetTest(globals.test)
+		valuesSupplier = target.NewValuesSupplier()
+		targetFunctions = target.NewFunctionsSupplier()
+		writtenFields = targetWriter.Fields()
 	}
-	targetWriter.SetTest(globals.test)
-
-	valuesSupplier := target.NewValuesSupplier()
-	targetFunctions := target.NewFunctionsSupplier()
 
+	unmapped := newUnmappedValues()
+	var firstsLock sync.Mutex
 	firsts := make(map[string]map[string]struct{})
 	functionsSupplier := func(name string, args []interface{}) (interface{}, error) {
 		switch name {
@@ -98,6 +137,8 @@ func (job *Job) Execute(globals *Globals) (err error) {
 				return true, nil
 			}
 			name := eval.MustBeString(args, 0)
+			firstsLock.Lock()
+			defer firstsLock.Unlock()
 			f, ok := firsts[name]
 			if !ok {
 				f = make(map[string]struct{})
@@ -110,24 +151,38 @@ func (job *Job) Execute(globals *Globals) (err error) {
 			}
 			f[types.String(args[1])] = struct{}{}
 			return true, nil
+		case "MAP":
+			return mapValue(globals.mappings, unmapped, args)
 		}
 		return nil, eval.NOFUNC{}
 	}
 
+	// job salt overrides masking functions of globals
+	var jobMasking eval.Functions
+	if job.Salt != "" {
+		jobMasking = newMaskingFunctions(job.Salt)
+	}
+
 	// create reporters
 	defaultName := job.Label + time.Now().Format("-20060102150405")
-	reporter = report.NewReporter(&job.Logs, defaultName, sourceReader.Fields(), targetWriter.Fields())
-
-NEXTREC:
-	for {
-		sourceRecord, err := sourceReader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return errors.New(fmt.Sprint("error reading source ", sourceReader.Location(), "\n", err))
+	reporter = report.NewReporter(&job.Logs, defaultName, sourceReader.Fields(), writtenFields)
+	defer func() {
+		rows := unmapped.rows()
+		if len(rows) > 0 {
+			log.Println(commons.PROGRESS, len(rows), " distinct values not found in mappings")
 		}
+		report.WriteUnmapped(&job.Logs, defaultName, rows)
+	}()
 
-		report := reporter.NewReport(sourceRecord, sourceReader.Location())
+	// transform evaluates skips and rules for one source record, it is called concurrently by transformers
+	transform := func(item *sourceItem) (result *transformed) {
+		result = &transformed{seq: item.seq, report: item.report}
+		defer func() {
+			if r := recover(); r != nil {
+				result.panic = r
+			}
+		}()
+		sourceRecord := item.record
 
 		// create name resolving function used in expressions
 		context := eval.NewContext()
@@ -155,7 +210,9 @@ NEXTREC:
 			}
 			return nil, false
 		})
-		context.AddValues(valuesSupplier)
+		if valuesSupplier != nil {
+			context.AddValues(valuesSupplier)
+		}
 		context.AddValues(globals.values)
 		context.AddFunctions(func(name string, args []interface{}) (interface{}, error) {
 			if name == "GET" {
@@ -170,8 +227,14 @@ NEXTREC:
 			return nil, eval.NOFUNC{}
 		})
 		context.AddFunctions(functionsSupplier)
-		context.AddFunctions(targetFunctions)
+		if targetFunctions != nil {
+			context.AddFunctions(targetFunctions)
+		}
+		if jobMasking != nil {
+			context.AddFunctions(jobMasking)
+		}
 		context.AddFunctions(globals.functions)
+		result.context = context
 
 		// handle all skips
 		for _, skip := range skips {
@@ -182,8 +245,8 @@ NEXTREC:
 			switch v.(type) {
 			case bool:
 				if v.(bool) {
-					report.Skip()
-					goto NEXTREC
+					result.skip = fmt.Sprint("skipped by rule: ", skip.Skip)
+					return result
 				}
 			default:
 				//TODO make fail to be skip and write to skip file
@@ -191,11 +254,21 @@ NEXTREC:
 			}
 		}
 
+		if targetWriter == nil {
+			violations, err := evalChecks(job.Checks, context)
+			if err != nil {
+				result.err = err.Error()
+			}
+			result.violations = violations
+			return result
+		}
+
 		targetRecord := targetWriter.NewRecord()
 
 		for _, rule := range job.Rules {
 			var targetValue interface{}
 			var ok bool
+			var err error
 			if rule.Source != "" {
 				targetValue, ok = sourceRecord.Get(rule.Source)
 				if !ok {
@@ -204,37 +277,195 @@ NEXTREC:
 			} else if rule.formula != nil {
 				targetValue, err = rule.formula.Eval(context)
 				if err != nil {
-					report.Error(fmt.Sprint("error in formula: ", err))
-					goto NEXTREC
+					result.err = fmt.Sprint("error in formula: ", err)
+					return result
 				}
 			}
 			omit := false
 			if rule.omit != nil {
 				o, err := rule.omit.Eval(context)
 				if err != nil {
-					report.Error(fmt.Sprint("error in omit: ", err))
-					goto NEXTREC
+					result.err = fmt.Sprint("error in omit: ", err)
+					return result
 				}
 				if omit, ok = o.(bool); !ok {
-					report.Error(fmt.Sprint("omit should evaluate to boolean", o))
-					goto NEXTREC
+					result.err = fmt.Sprint("omit should evaluate to boolean", o)
+					return result
 				}
 			}
 			if rule.Target != "" && !omit {
 				if _, err := targetRecord.Set(rule.Target, targetValue); err != nil {
-					report.Error(err.Error())
-					goto NEXTREC
+					result.err = err.Error()
+					return result
 				}
 			}
 		}
-		err = targetWriter.Write(targetRecord, report, context)
-		if err != nil {
-			report.Error(fmt.Sprint("error writing target: ", err))
+		result.record = targetRecord
+		return result
+	}
+
+	// reader -> transformers -> writer pipeline, done is closed to stop reader and transformers on early return
+	done := make(chan struct{})
+	defer close(done)
+	numTransformers := job.Transformers
+	if numTransformers > 1 && job.usesFirst() {
+		log.Println(commons.PROGRESS, "job ", job.Label, " uses FIRST, records are transformed by one transformer")
+		numTransformers = 1
+	}
+	if numTransformers <= 0 {
+		numTransformers = 1
+	}
+	items := make(chan *sourceItem, numTransformers*2)
+	results := make(chan *transformed, numTransformers*2)
+	// window limits records read but not written yet, so results waiting for a slow record do not pile up
+	window := make(chan struct{}, numTransformers*READ_AHEAD)
+	var readErr error
+	go func() {
+		defer close(items)
+		for seq := 0; ; seq++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			sourceRecord, err := sourceReader.Read()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				readErr = errors.New(fmt.Sprint("error reading source ", sourceReader.Location(), "\n", err))
+				return
+			}
+			item := &sourceItem{seq: seq, record: sourceRecord, report: reporter.NewReport(sourceRecord, sourceReader.Location())}
+			select {
+			case items <- item:
+			case <-done:
+				return
+			}
+		}
+	}()
+	var transformers sync.WaitGroup
+	for i := 0; i < numTransformers; i++ {
+		transformers.Add(1)
+		go func() {
+			defer transformers.Done()
+			for item := range items {
+				select {
+				case results <- transform(item):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		transformers.Wait()
+		close(results)
+	}()
+
+	// write transformed records in the source order
+	checks := newVerdict()
+	pending := make(map[int]*transformed)
+	next := 0
+	for result := range results {
+		pending[result.seq] = result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+			if result.panic != nil {
+				panic(result.panic)
+			}
+			if result.skip != "" {
+				result.report.Skip(result.skip)
+			} else if result.err != "" {
+				result.report.Error(result.err)
+				if targetWriter == nil {
+					checks.unchecked()
+				}
+			} else if targetWriter == nil {
+				checks.add(result.violations)
+				for _, check := range result.violations {
+					result.report.Violation(check.Name, check.Severity, check.Message)
+				}
+				// every checked record is reported, failed ones to error log and passed ones to success log
+				if failed := failedChecks(result.violations, CHECK_ERROR); len(failed) > 0 {
+					result.report.Error(fmt.Sprint("failed checks: ", strings.Join(failed, ", ")))
+				} else if warnings := failedChecks(result.violations, CHECK_WARNING); len(warnings) > 0 {
+					result.report.Success(false, "", "checks passed", fmt.Sprint("warnings: ", strings.Join(warnings, ", ")))
+				} else {
+					result.report.Success(false, "", "checks passed")
+				}
+			} else {
+				err = targetWriter.Write(result.record, result.report, result.context)
+				if abort, ok := err.(*commons.AbortError); ok {
+					return errors.New(fmt.Sprint("job ", job.Label, " aborted: ", abort))
+				} else if err != nil {
+					result.report.Error(fmt.Sprint("error writing target: ", err))
+				}
+			}
 		}
 	}
+	if readErr != nil {
+		return readErr
+	}
+	if targetWriter == nil {
+		for _, line := range checks.summary(job.Label) {
+			log.Println(commons.PROGRESS, line)
+		}
+		if !checks.passed() {
+			return errors.New(fmt.Sprint("checks of job ", job.Label, " failed, ", checks.failed, " of ", checks.records,
+				" records have errors"))
+		}
+		return nil
+	}
 	err = targetWriter.Flush()
 	if err != nil {
 		return errors.New(fmt.Sprint("error flushing target: ", err))
 	}
+	// close writer before reporter, writers could report results on close
+	err = targetWriter.Close()
+	targetWriter = nil
+	if err != nil {
+		return errors.New(fmt.Sprint("error closing target: ", err))
+	}
 	return nil
 }
+
+// usesFirst tells if any expression of the job calls FIRST. Records are evaluated by one transformer then,
+// so the first record is the same in every run.
+func (job *Job) usesFirst() bool {
+	for _, rule := range job.Rules {
+		for _, s := range []string{rule.Formula, rule.Skip, rule.Omit} {
+			if firstCall.MatchString(s) {
+				return true
+			}
+		}
+	}
+	for _, check := range job.Checks {
+		if firstCall.MatchString(check.Condition) {
+			return true
+		}
+	}
+	return false
+}
+
+type sourceItem struct {
+	seq    int
+	record commons.Record
+	report jobReport
+}
+
+type transformed struct {
+	seq        int
+	report     jobReport
+	violations []*Check
+	record     commons.Record
+	context    eval.Context
+	skip       string
+	err        string
+	panic      interface{}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	types "github.com/goforce/api/commons"
+	"github.com/goforce/eval"
+	"github.com/goforce/reloader/csv"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	MAPPING_ON_MISS_DEFAULT string = "default"
+	MAPPING_ON_MISS_KEEP    string = "keep"
+	MAPPING_ON_MISS_ERROR   string = "error"
+)
+
+// mapCall matches calls of MAP function with name of the mapping given as string literal
+var mapCall = regexp.MustCompile(`(?i)\bMAP\s*\(\s*(?:"([^"]*)"|'([^']*)')`)
+
+// Mapping is named translation table used by MAP function. Values are given inline or read from csv file, from and to
+// name columns of the file, first and second columns are used by default. Values not found are counted as unmapped
+// and translated according to onMiss: to default value (default), to the value itself (keep) or to error (error).
+type Mapping struct {
+	Values        map[string]string `json:"values"`
+	Csv           *csv.CsvSource    `json:"csv"`
+	From          string            `json:"from"`
+	To            string            `json:"to"`
+	Default       *string           `json:"default"`
+	OnMiss        string            `json:"onMiss"`
+	CaseSensitive bool              `json:"caseSensitive"`
+	values        map[string]string
+}
+
+func (m *Mapping) Init(resolver func(string) string) error {
+	if m.Values == nil && m.Csv == nil {
+		return errors.New("either values or csv should be specified")
+	}
+	m.OnMiss = strings.ToLower(m.OnMiss)
+	if m.OnMiss == "" {
+		m.OnMiss = MAPPING_ON_MISS_DEFAULT
+	}
+	if m.OnMiss != MAPPING_ON_MISS_DEFAULT && m.OnMiss != MAPPING_ON_MISS_KEEP && m.OnMiss != MAPPING_ON_MISS_ERROR {
+		return errors.New(fmt.Sprint("unknown onMiss: ", m.OnMiss, ", expected default, keep or error"))
+	}
+	if m.Default != nil && m.OnMiss != MAPPING_ON_MISS_DEFAULT {
+		return errors.New(fmt.Sprint("default value can not be used with onMiss: ", m.OnMiss))
+	}
+	m.values = make(map[string]string)
+	for k, v := range m.Values {
+		if err := m.add(k, v); err != nil {
+			return err
+		}
+	}
+	if m.Csv != nil {
+		if err := m.Csv.Init(resolver); err != nil {
+			return err
+		}
+		return m.read()
+	}
+	return nil
+}
+
+func (m *Mapping) key(value string) string {
+	if m.CaseSensitive {
+		return strings.TrimSpace(value)
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func (m *Mapping) add(from string, to string) error {
+	key := m.key(from)
+	if v, ok := m.values[key]; ok && v != to {
+		return errors.New(fmt.Sprint("value mapped more than once: ", from))
+	}
+	m.values[key] = to
+	return nil
+}
+
+// read adds values of csv file to the mapping
+func (m *Mapping) read() error {
+	reader, err := m.Csv.NewReader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	from, to := m.From, m.To
+	fields := reader.Fields()
+	if from == "" && len(fields) > 0 {
+		from = fields[0]
+	}
+	if to == "" && len(fields) > 1 {
+		to = fields[1]
+	}
+	if !containsField(fields, from) || !containsField(fields, to) {
+		return errors.New(fmt.Sprint("mapping file ", m.Csv.Path, " should have columns ", from, " and ", to))
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.New(fmt.Sprint("error reading mapping ", reader.Location(), "\n", err))
+		}
+		f, _ := record.Get(from)
+		t, _ := record.Get(to)
+		if err := m.add(types.String(f), types.String(t)); err != nil {
+			return errors.New(fmt.Sprint(err, " at ", reader.Location()))
+		}
+	}
+}
+
+func containsField(fields []string, name string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmappedValues counts values not found in mappings, it is shared by transformers of a job
+type unmappedValues struct {
+	lock   sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newUnmappedValues() *unmappedValues {
+	return &unmappedValues{counts: make(map[string]map[string]int)}
+}
+
+func (u *unmappedValues) add(mapping string, value string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	values, ok := u.counts[mapping]
+	if !ok {
+		values = make(map[string]int)
+		u.counts[mapping] = values
+	}
+	values[value]++
+}
+
+// rows returns mapping, value and count of unmapped values, ordered by mapping and most frequent values first
+func (u *unmappedValues) rows() [][]string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	names := make([]string, 0, len(u.counts))
+	for name := range u.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0)
+	for _, name := range names {
+		values := make([]string, 0, len(u.counts[name]))
+		for v := range u.counts[name] {
+			values = append(values, v)
+		}
+		counts := u.counts[name]
+		sort.Slice(values, func(i, j int) bool {
+			if counts[values[i]] != counts[values[j]] {
+				return counts[values[i]] > counts[values[j]]
+			}
+			return values[i] < values[j]
+		})
+		for _, v := range values {
+			rows = append(rows, []string{name, v, fmt.Sprint(counts[v])})
+		}
+	}
+	return rows
+}
+
+// mappingNames returns names of mappings used by MAP calls of the expression, so they could be checked before run
+func mappingNames(expr string) []string {
+	names := make([]string, 0)
+	for _, m := range mapCall.FindAllStringSubmatch(expr, -1) {
+		names = append(names, m[1]+m[2])
+	}
+	return names
+}
+
+// mapValue implements MAP(name, value), null is mapped to null and is never unmapped
+func mapValue(mappings map[string]*Mapping, unmapped *unmappedValues, args []interface{}) (interface{}, error) {
+	eval.NumOfParams(args, 2)
+	name := eval.MustBeString(args, 0)
+	m, ok := mappings[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprint("MAP: no such mapping: ", name))
+	}
+	if args[1] == nil {
+		return nil, nil
+	}
+	value := types.String(args[1])
+	if v, ok := m.values[m.key(value)]; ok {
+		return v, nil
+	}
+	unmapped.add(name, value)
+	switch m.OnMiss {
+	case MAPPING_ON_MISS_KEEP:
+		return value, nil
+	case MAPPING_ON_MISS_ERROR:
+		return nil, errors.New(fmt.Sprint("MAP: value not mapped by ", name, ": ", value))
+	}
+	if m.Default == nil {
+		return nil, nil
+	}
+	return *m.Default, nil
+}
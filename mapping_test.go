@@ -0,0 +1,153 @@
+package main
+
+import (
+	"github.com/goforce/reloader/csv"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func noresolve(s string) string {
+	return s
+}
+
+func testMappings(t *testing.T) map[string]*Mapping {
+	other := "Other"
+	mappings := map[string]*Mapping{
+		"status": &Mapping{Values: map[string]string{"Open": "New", "closed": "Done"}, Default: &other},
+		"plain":  &Mapping{Values: map[string]string{"A": "1"}},
+		"keep":   &Mapping{Values: map[string]string{"A": "1"}, OnMiss: "keep"},
+		"strict": &Mapping{Values: map[string]string{"A": "1"}, OnMiss: "ERROR"},
+		"cased":  &Mapping{Values: map[string]string{"A": "1"}, OnMiss: "keep", CaseSensitive: true},
+	}
+	for name, m := range mappings {
+		if err := m.Init(noresolve); err != nil {
+			t.Fatal(name, ": ", err)
+		}
+	}
+	return mappings
+}
+
+func TestMapValue(t *testing.T) {
+	mappings := testMappings(t)
+	tests := []struct {
+		mapping  string
+		value    interface{}
+		expected interface{}
+		err      string
+	}{
+		{"status", "Open", "New", ""},
+		{"status", " OPEN ", "New", ""},
+		{"status", "Closed", "Done", ""},
+		{"status", "Pending", "Other", ""},
+		{"plain", "B", nil, ""},
+		{"keep", "B", "B", ""},
+		{"strict", "a", "1", ""},
+		{"strict", "B", nil, "not mapped"},
+		{"cased", "a", "a", ""},
+		{"cased", "A", "1", ""},
+		{"status", nil, nil, ""},
+		{"missing", "A", nil, "no such mapping"},
+	}
+	for _, test := range tests {
+		v, err := mapValue(mappings, newUnmappedValues(), []interface{}{test.mapping, test.value})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Error(test.mapping, " ", test.value, ": expected error ", test.err, ", got: ", err)
+			}
+			continue
+		}
+		if err != nil || v != test.expected {
+			t.Error(test.mapping, " ", test.value, ": expected ", test.expected, ", got: ", v, " ", err)
+		}
+	}
+}
+
+func TestMapValueUnmapped(t *testing.T) {
+	mappings := testMappings(t)
+	unmapped := newUnmappedValues()
+	for _, v := range []interface{}{"Open", "Pending", nil, "Pending"} {
+		mapValue(mappings, unmapped, []interface{}{"status", v})
+	}
+	if rows := unmapped.rows(); len(rows) != 1 || rows[0][1] != "Pending" || rows[0][2] != "2" {
+		t.Fatal("unexpected unmapped values: ", rows)
+	}
+}
+
+func writeMappingFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mapping.csv")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMappingRead(t *testing.T) {
+	tests := []struct {
+		content string
+		from    string
+		to      string
+		err     string
+		values  map[string]string
+	}{
+		// first and second columns are used by default
+		{"code,name,note\nUS,United States,x\nDE,Germany,y\n", "", "", "", map[string]string{"us": "United States", "de": "Germany"}},
+		{"code,name,note\nUS,United States,x\n", "note", "code", "", map[string]string{"x": "US"}},
+		{"code\nUS\n", "", "", "should have columns", nil},
+		{"code,name\nUS,United States\n", "code", "label", "should have columns", nil},
+		// duplicates with the same value are allowed
+		{"code,name\nUS,United States\nus,United States\n", "", "", "", map[string]string{"us": "United States"}},
+		{"code,name\nUS,United States\nus,USA\n", "", "", "mapped more than once", nil},
+	}
+	for i, test := range tests {
+		m := &Mapping{Csv: &csv.CsvSource{Path: writeMappingFile(t, test.content)}, From: test.from, To: test.to}
+		err := m.Init(noresolve)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Error("#", i, ": expected error ", test.err, ", got: ", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("#", i, ": ", err)
+			continue
+		}
+		if len(m.values) != len(test.values) {
+			t.Error("#", i, ": unexpected values: ", m.values)
+		}
+		for k, v := range test.values {
+			if m.values[k] != v {
+				t.Error("#", i, ": expected ", k, " mapped to ", v, ", got: ", m.values[k])
+			}
+		}
+	}
+}
+
+func TestUnmappedRows(t *testing.T) {
+	unmapped := newUnmappedValues()
+	for _, v := range []string{"b", "c", "a", "c", "a", "c"} {
+		unmapped.add("status", v)
+	}
+	unmapped.add("country", "XX")
+	expected := [][]string{{"country", "XX", "1"}, {"status", "c", "3"}, {"status", "a", "2"}, {"status", "b", "1"}}
+	rows := unmapped.rows()
+	if len(rows) != len(expected) {
+		t.Fatal("unexpected rows: ", rows)
+	}
+	for i, row := range rows {
+		if strings.Join(row, ",") != strings.Join(expected[i], ",") {
+			t.Error("row ", i, ": expected ", expected[i], ", got: ", row)
+		}
+	}
+}
+
+func TestMappingNames(t *testing.T) {
+	names := mappingNames(`IF(ISBLANK(Status), MAP("status", Type), map ( 'country', Country))`)
+	if len(names) != 2 || names[0] != "status" || names[1] != "country" {
+		t.Fatal("unexpected names: ", names)
+	}
+	if names := mappingNames(`MAP(name, Type)`); len(names) != 0 {
+		t.Fatal("expected names only of literals: ", names)
+	}
+}
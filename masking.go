@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	types "github.com/goforce/api/commons"
+	"github.com/goforce/eval"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var firstNames = []string{
+	"Alex", "Anna", "Ben", "Carla", "Daniel", "Diana", "Eric", "Elena", "Frank", "Fiona",
+	"George", "Grace", "Henry", "Helen", "Ivan", "Irene", "Jack", "Julia", "Kevin", "Karen",
+	"Leo", "Laura", "Martin", "Maria", "Nick", "Nora", "Oscar", "Olivia", "Paul", "Paula",
+	"Robert", "Rita", "Sam", "Sofia", "Tom", "Tina", "Victor", "Vera", "William", "Zoe",
+}
+
+var lastNames = []string{
+	"Adams", "Baker", "Clark", "Davis", "Evans", "Fisher", "Green", "Harris", "Irwin", "Jones",
+	"King", "Lewis", "Miller", "Nelson", "Owens", "Parker", "Quinn", "Roberts", "Scott", "Turner",
+	"Walker", "White", "Young", "Allen", "Brooks", "Carter", "Dixon", "Ellis", "Foster", "Gray",
+	"Hughes", "Jenkins", "Kelly", "Lawson", "Morgan", "Norris", "Palmer", "Reed", "Stone", "Wood",
+}
+
+// maskingCall matches calls of masking functions, they need salt so masked values could not be reversed by dictionary
+var maskingCall = regexp.MustCompile(`(?i)\b(MASK|PSEUDONYM|MASKEMAIL|MASKPHONE|MASKNUMBER|SHIFTDATE)\s*\(`)
+
+// usesMasking tells if the expression calls masking functions
+func usesMasking(expr string) bool {
+	return maskingCall.MatchString(expr)
+}
+
+// newMaskingFunctions returns functions used to mask personal data. Results depend only on the input value and salt,
+// so the same value is masked in the same way in all jobs sharing the salt and lookups by masked values keep working.
+func newMaskingFunctions(salt string) eval.Functions {
+	hash := func(purpose string, value string) []byte {
+		mac := hmac.New(sha256.New, []byte(salt))
+		mac.Write([]byte(purpose))
+		mac.Write([]byte{0})
+		mac.Write([]byte(value))
+		return mac.Sum(nil)
+	}
+	pick := func(list []string, purpose string, value string) string {
+		h := hash(purpose, strings.ToLower(value))
+		return list[binary.BigEndian.Uint32(h)%uint32(len(list))]
+	}
+	return func(name string, args []interface{}) (interface{}, error) {
+		switch name {
+		case "MASK":
+			eval.NumOfParams(args, 1)
+			if args[0] == nil {
+				return nil, nil
+			}
+			return hex.EncodeToString(hash("mask", types.String(args[0])))[:16], nil
+		case "PSEUDONYM":
+			eval.MinNumOfParams(args, 1)
+			if args[0] == nil {
+				return nil, nil
+			}
+			kind := "full"
+			if len(args) > 1 {
+				kind = strings.ToLower(eval.MustBeString(args, 1))
+			}
+			words := strings.Fields(types.String(args[0]))
+			for i, w := range words {
+				if kind == "last" || (kind == "full" && i == len(words)-1 && len(words) > 1) {
+					words[i] = pick(lastNames, "last", w)
+				} else {
+					words[i] = pick(firstNames, "first", w)
+				}
+			}
+			return strings.Join(words, " "), nil
+		case "MASKEMAIL":
+			eval.NumOfParams(args, 1)
+			if args[0] == nil {
+				return nil, nil
+			}
+			email := types.String(args[0])
+			at := strings.LastIndex(email, "@")
+			if at < 0 {
+				return nil, errors.New(fmt.Sprint("MASKEMAIL: not an email: ", email))
+			}
+			local := hex.EncodeToString(hash("email", strings.ToLower(email)))[:10]
+			return "user" + local + email[at:], nil
+		case "MASKPHONE", "MASKNUMBER":
+			eval.NumOfParams(args, 1)
+			if args[0] == nil {
+				return nil, nil
+			}
+			var s string
+			if r, ok := args[0].(*big.Rat); ok {
+				if r.IsInt() {
+					s = r.Num().String()
+				} else {
+					s = r.FloatString(decimals(r))
+				}
+			} else {
+				s = types.String(args[0])
+			}
+			h := hash("number", s)
+			masked := []rune(s)
+			first := true
+			for i, c := range masked {
+				if !unicode.IsDigit(c) {
+					continue
+				}
+				d := h[i%len(h)] % 10
+				if first && c != '0' && d == 0 {
+					d = 1 + h[(i+1)%len(h)]%9
+				}
+				first = false
+				masked[i] = rune('0' + d)
+			}
+			if _, ok := args[0].(*big.Rat); ok {
+				r, _ := new(big.Rat).SetString(string(masked))
+				return r, nil
+			}
+			return string(masked), nil
+		case "SHIFTDATE":
+			// SHIFTDATE(date, maxDays [, key]) shifts date by up to maxDays in both directions, shift is taken from key if
+			// provided so all dates of one record could be shifted by the same number of days
+			eval.MinNumOfParams(args, 2)
+			if args[0] == nil {
+				return nil, nil
+			}
+			maxDays, ok := args[1].(*big.Rat)
+			if !ok || !maxDays.IsInt() || maxDays.Sign() < 0 {
+				return nil, errors.New(fmt.Sprint("SHIFTDATE: number of days should be non negative integer: ", args[1]))
+			}
+			key := types.String(args[0])
+			if len(args) > 2 {
+				key = types.String(args[2])
+			}
+			span := 2*maxDays.Num().Int64() + 1
+			days := int64(binary.BigEndian.Uint64(hash("date", key))%uint64(span)) - maxDays.Num().Int64()
+			switch args[0].(type) {
+			case time.Time:
+				return args[0].(time.Time).AddDate(0, 0, int(days)), nil
+			default:
+				s := types.String(args[0])
+				for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05.000Z0700"} {
+					if t, err := time.Parse(layout, s); err == nil {
+						return t.AddDate(0, 0, int(days)).Format(layout), nil
+					}
+				}
+				return nil, errors.New(fmt.Sprint("SHIFTDATE: not a date: ", s))
+			}
+		}
+		return nil, eval.NOFUNC{}
+	}
+}
+
+// decimals returns number of decimal digits needed to print finite decimal fraction, limited to 10
+func decimals(r *big.Rat) int {
+	for i := 0; i < 10; i++ {
+		n := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(i)), nil)))
+		if n.IsInt() {
+			return i
+		}
+	}
+	return 10
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mask(t *testing.T, salt string, name string, args ...interface{}) interface{} {
+	v, err := newMaskingFunctions(salt)(name, args)
+	if err != nil {
+		t.Fatal(name, ": ", err)
+	}
+	return v
+}
+
+func TestMaskingDeterministic(t *testing.T) {
+	for _, name := range []string{"MASK", "PSEUDONYM", "MASKEMAIL", "MASKPHONE"} {
+		value := "John Smith"
+		if name == "MASKEMAIL" {
+			value = "john.smith@example.com"
+		} else if name == "MASKPHONE" {
+			value = "+1 555 123 4567"
+		}
+		first := mask(t, "salt", name, value)
+		if second := mask(t, "salt", name, value); first != second {
+			t.Error(name, ": expected the same value, got ", first, " and ", second)
+		}
+		if other := mask(t, "pepper", name, value); name != "PSEUDONYM" && first == other {
+			t.Error(name, ": expected value depending on salt, got ", other)
+		}
+		if first == value {
+			t.Error(name, ": value not masked: ", first)
+		}
+	}
+	if v := mask(t, "salt", "MASK", nil); v != nil {
+		t.Fatal("expected null masked as null: ", v)
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	masked := mask(t, "salt", "MASKEMAIL", "John.Smith@Example.com").(string)
+	if !strings.HasPrefix(masked, "user") || !strings.HasSuffix(masked, "@Example.com") || strings.Contains(masked, "Smith") {
+		t.Fatal("expected domain kept: ", masked)
+	}
+	if _, err := newMaskingFunctions("salt")("MASKEMAIL", []interface{}{"not an email"}); err == nil {
+		t.Fatal("expected error of not an email")
+	}
+}
+
+func TestMaskPhone(t *testing.T) {
+	phone := "+1 (555) 123-4567"
+	masked := mask(t, "salt", "MASKPHONE", phone).(string)
+	if len(masked) != len(phone) || masked == phone {
+		t.Fatal("unexpected masked phone: ", masked)
+	}
+	for i := range phone {
+		if (phone[i] >= '0' && phone[i] <= '9') != (masked[i] >= '0' && masked[i] <= '9') {
+			t.Fatal("expected format of phone kept: ", masked)
+		}
+	}
+	if masked[1] == '0' {
+		t.Fatal("expected first digit not zero: ", masked)
+	}
+	if n := mask(t, "salt", "MASKNUMBER", big.NewRat(12345, 1)).(*big.Rat); !n.IsInt() || len(n.Num().String()) != 5 {
+		t.Fatal("unexpected masked number: ", n)
+	}
+}
+
+func TestShiftDate(t *testing.T) {
+	days := big.NewRat(10, 1)
+	shifted := mask(t, "salt", "SHIFTDATE", "2019-06-15", days).(string)
+	d, err := time.Parse("2006-01-02", shifted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := d.Sub(time.Date(2019, 6, 15, 0, 0, 0, 0, time.UTC)).Hours() / 24; diff < -10 || diff > 10 {
+		t.Fatal("date shifted too far: ", shifted)
+	}
+	// dates shifted by key of the record keep distance between them
+	start := mask(t, "salt", "SHIFTDATE", time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), days, "001000000000001").(time.Time)
+	end := mask(t, "salt", "SHIFTDATE", time.Date(2019, 6, 30, 0, 0, 0, 0, time.UTC), days, "001000000000001").(time.Time)
+	if end.Sub(start).Hours() != 29*24 {
+		t.Fatal("expected dates shifted by the same number of days: ", start, end)
+	}
+	if _, err := newMaskingFunctions("salt")("SHIFTDATE", []interface{}{"15.06.2019", days}); err == nil {
+		t.Fatal("expected error of not a date")
+	}
+}
+
+func TestUsesMasking(t *testing.T) {
+	for expr, expected := range map[string]bool{
+		"MASKEMAIL(Email)":          true,
+		"shiftdate (Birthdate, 30)": true,
+		"UPPER(Name)":               false,
+		"MASKED__c":                 false,
+		"":                          false,
+	} {
+		if usesMasking(expr) != expected {
+			t.Error("usesMasking ", expr, ": expected ", expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goforce/reloader/commons"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// plannedJob keeps objects a job writes to and references, used to order jobs
+type plannedJob struct {
+	job        *Job
+	sObject    string
+	creates    bool
+	references map[string][]string
+}
+
+// Plan orders jobs so that jobs creating parent records run before jobs referencing them. Jobs reading csv files
+// written by other jobs are run after them. Returned messages describe cycles and suggest two pass loading.
+func (config *Config) Plan() ([]*Job, []string, error) {
+	planned := make([]*plannedJob, len(config.Jobs))
+	for i, job := range config.Jobs {
+		planned[i] = &plannedJob{job: job, references: make(map[string][]string)}
+		if target := job.Target.Salesforce; target != nil {
+			planned[i].sObject = strings.ToLower(target.SObject)
+			op := strings.ToUpper(target.Operation)
+			planned[i].creates = op == "INSERT" || op == "UPSERT"
+			fields := make([]string, 0, len(job.Rules))
+			for _, rule := range job.Rules {
+				if rule.Target != "" {
+					fields = append(fields, rule.Target)
+				}
+			}
+			references, err := target.References(fields)
+			if err != nil {
+				return nil, nil, errors.New(fmt.Sprint("error planning job ", job.Label, ": ", err))
+			}
+			planned[i].references = references
+		}
+	}
+	nodes := make([]string, len(planned))
+	dependsOn := make(map[string][]string)
+	for i, p := range planned {
+		nodes[i] = strconv.Itoa(i)
+		for j, other := range planned {
+			if i != j && p.dependsOn(other) {
+				dependsOn[nodes[i]] = append(dependsOn[nodes[i]], strconv.Itoa(j))
+			}
+		}
+	}
+	ordered, cyclic := commons.TopologicalOrder(nodes, dependsOn)
+	messages := make([]string, 0)
+	for _, p := range planned {
+		for _, field := range p.referenceFields() {
+			for _, o := range p.references[field] {
+				if p.creates && strings.EqualFold(o, p.sObject) {
+					messages = append(messages, fmt.Sprint("job ", p.job.Label, " references records of its own object by ", field,
+						", consider two pass loading with deferredFields: [\"", field, "\"]"))
+				}
+			}
+		}
+	}
+	if len(cyclic) > 0 {
+		// jobs of the cycle are listed by label
+		byLabel := append([]string{}, cyclic...)
+		sort.SliceStable(byLabel, func(i, j int) bool {
+			return planned[index(byLabel[i])].job.Label < planned[index(byLabel[j])].job.Label
+		})
+		labels := make([]string, len(byLabel))
+		for i, n := range byLabel {
+			labels[i] = planned[index(n)].job.Label
+		}
+		messages = append(messages, fmt.Sprint("circular references between jobs: ", strings.Join(labels, ", ")))
+		for _, n := range byLabel {
+			p := planned[index(n)]
+			for _, field := range p.referenceFields() {
+				for _, m := range byLabel {
+					other := planned[index(m)]
+					if other != p && other.creates && commons.ContainsFold(p.references[field], other.sObject) {
+						messages = append(messages, fmt.Sprint("two pass plan: run job ", p.job.Label, " without ", field,
+							", then update ", field, " after job ", other.job.Label))
+					}
+				}
+			}
+		}
+	}
+	jobs := make([]*Job, 0, len(planned))
+	for _, n := range append(ordered, cyclic...) {
+		jobs = append(jobs, planned[index(n)].job)
+	}
+	return jobs, messages, nil
+}
+
+// dependsOn returns true if job references objects created by other job or reads file written by other job
+func (p *plannedJob) dependsOn(other *plannedJob) bool {
+	if other.creates && other.sObject != p.sObject {
+		for _, objects := range p.references {
+			if commons.ContainsFold(objects, other.sObject) {
+				return true
+			}
+		}
+	}
+	if p.job.Source.Csv != nil && other.job.Target.Csv != nil && other.job.Target.Csv.Path != nil {
+		return p.job.Source.Csv.Path == *other.job.Target.Csv.Path
+	}
+	return false
+}
+
+// referenceFields returns sorted names of reference fields, so messages are the same in every run
+func (p *plannedJob) referenceFields() []string {
+	fields := make([]string, 0, len(p.references))
+	for field := range p.references {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func index(node string) int {
+	i, _ := strconv.Atoi(node)
+	return i
+}
@@ -0,0 +1,244 @@
+package profile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	types "github.com/goforce/api/commons"
+	"github.com/goforce/reloader/commons"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// default number of most frequent values reported for each field
+const DEFAULT_TOP int = 10
+
+// Profile describes values of all fields of a source and duplicates of the key
+type Profile struct {
+	Records int             `json:"records"`
+	Fields  []*FieldProfile `json:"fields"`
+	Key     *KeyProfile     `json:"key,omitempty"`
+}
+
+// FieldProfile describes values of one field. Blank values are not null values having only spaces, they are not
+// counted as distinct values. Duplicates is number of distinct values found more than once.
+type FieldProfile struct {
+	Field      string       `json:"field"`
+	Nulls      int          `json:"nulls"`
+	Blanks     int          `json:"blanks"`
+	Distinct   int          `json:"distinct"`
+	Duplicates int          `json:"duplicates"`
+	MinLength  int          `json:"minLength"`
+	MaxLength  int          `json:"maxLength"`
+	Top        []ValueCount `json:"top"`
+	Patterns   []ValueCount `json:"patterns"`
+	values     map[string]int
+	patterns   map[string]int
+}
+
+// KeyProfile lists values of the key found more than once, key of several fields is joined by |. Records with
+// all key fields null or blank are counted as nulls and are not duplicates.
+type KeyProfile struct {
+	Fields     []string     `json:"fields"`
+	Nulls      int          `json:"nulls"`
+	Duplicates []ValueCount `json:"duplicates"`
+	values     map[string]int
+}
+
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+var patterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"integer", regexp.MustCompile(`^[-+]?\d+$`)},
+	{"decimal", regexp.MustCompile(`^[-+]?\d*[.,]\d+$`)},
+	{"boolean", regexp.MustCompile(`(?i)^(true|false)$`)},
+	{"date yyyy-mm-dd", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)},
+	{"datetime yyyy-mm-ddThh:mm:ss", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[-+]\d{2}:?\d{2})?$`)},
+	{"date dd.mm.yyyy", regexp.MustCompile(`^\d{1,2}\.\d{1,2}\.\d{4}$`)},
+	{"date nn/nn/yyyy", regexp.MustCompile(`^\d{1,2}/\d{1,2}/\d{4}$`)},
+	{"email", regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)},
+	{"salesforce id", regexp.MustCompile(`^[a-zA-Z0-9]{3}0[a-zA-Z0-9]{11}([a-zA-Z0-9]{3})?$`)},
+}
+
+// pattern returns name of the pattern matching value, values read from salesforce are detected by their type
+func pattern(value interface{}, s string) string {
+	switch value.(type) {
+	case time.Time:
+		return "datetime"
+	case *big.Rat:
+		if value.(*big.Rat).IsInt() {
+			return "integer"
+		}
+		return "decimal"
+	case bool:
+		return "boolean"
+	}
+	for _, p := range patterns {
+		if p.pattern.MatchString(s) {
+			return p.name
+		}
+	}
+	return "text"
+}
+
+// Read profiles all records of the reader, key fields are optional
+func Read(reader commons.Reader, key []string, top int) (*Profile, error) {
+	if top <= 0 {
+		top = DEFAULT_TOP
+	}
+	p := &Profile{Fields: make([]*FieldProfile, 0, len(reader.Fields()))}
+	for _, f := range reader.Fields() {
+		p.Fields = append(p.Fields, &FieldProfile{Field: f, MinLength: -1, values: make(map[string]int), patterns: make(map[string]int)})
+	}
+	if len(key) > 0 {
+		fields := make([]string, len(key))
+		for i, k := range key {
+			for _, f := range reader.Fields() {
+				if strings.EqualFold(f, k) {
+					fields[i] = f
+				}
+			}
+			if fields[i] == "" {
+				return nil, errors.New(fmt.Sprint("no such key field in source: ", k))
+			}
+		}
+		p.Key = &KeyProfile{Fields: fields, values: make(map[string]int)}
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New(fmt.Sprint("error reading source ", reader.Location(), "\n", err))
+		}
+		p.Records++
+		for _, fp := range p.Fields {
+			value, _ := record.Get(fp.Field)
+			fp.add(value)
+		}
+		if p.Key != nil {
+			parts := make([]string, len(p.Key.Fields))
+			null := true
+			for i, f := range p.Key.Fields {
+				if v, _ := record.Get(f); v != nil {
+					parts[i] = types.String(v)
+					null = null && strings.TrimSpace(parts[i]) == ""
+				}
+			}
+			if null {
+				p.Key.Nulls++
+			} else {
+				p.Key.values[strings.Join(parts, "|")]++
+			}
+		}
+	}
+	for _, fp := range p.Fields {
+		fp.Distinct = len(fp.values)
+		for _, count := range fp.values {
+			if count > 1 {
+				fp.Duplicates++
+			}
+		}
+		if fp.MinLength < 0 {
+			fp.MinLength = 0
+		}
+		fp.Top = mostFrequent(fp.values, top)
+		fp.Patterns = mostFrequent(fp.patterns, len(fp.patterns))
+	}
+	if p.Key != nil {
+		duplicates := make(map[string]int)
+		for v, count := range p.Key.values {
+			if count > 1 {
+				duplicates[v] = count
+			}
+		}
+		p.Key.Duplicates = mostFrequent(duplicates, len(duplicates))
+	}
+	return p, nil
+}
+
+func (fp *FieldProfile) add(value interface{}) {
+	if value == nil {
+		fp.Nulls++
+		return
+	}
+	s := types.String(value)
+	if strings.TrimSpace(s) == "" {
+		fp.Blanks++
+		return
+	}
+	fp.values[s]++
+	length := utf8.RuneCountInString(s)
+	if fp.MinLength < 0 || length < fp.MinLength {
+		fp.MinLength = length
+	}
+	if length > fp.MaxLength {
+		fp.MaxLength = length
+	}
+	fp.patterns[pattern(value, strings.TrimSpace(s))]++
+}
+
+// mostFrequent returns up to n values with highest counts, values with the same count are ordered by value
+func mostFrequent(values map[string]int, n int) []ValueCount {
+	counts := make([]ValueCount, 0, len(values))
+	for v, count := range values {
+		counts = append(counts, ValueCount{v, count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+func joinCounts(counts []ValueCount) string {
+	s := make([]string, len(counts))
+	for i, c := range counts {
+		s[i] = fmt.Sprint(c.Value, ":", c.Count)
+	}
+	return strings.Join(s, "; ")
+}
+
+// WriteCsv writes one row per field, duplicates of the key are written after fields as rows of field named by key.
+func (p *Profile) WriteCsv(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"field", "records", "nulls", "blanks", "distinct", "duplicates", "minLength", "maxLength", "patterns", "top"})
+	for _, fp := range p.Fields {
+		writer.Write([]string{
+			fp.Field, fmt.Sprint(p.Records), fmt.Sprint(fp.Nulls), fmt.Sprint(fp.Blanks), fmt.Sprint(fp.Distinct),
+			fmt.Sprint(fp.Duplicates), fmt.Sprint(fp.MinLength), fmt.Sprint(fp.MaxLength), joinCounts(fp.Patterns), joinCounts(fp.Top),
+		})
+	}
+	if p.Key != nil {
+		writer.Write([]string{
+			"key " + strings.Join(p.Key.Fields, "|"), fmt.Sprint(p.Records), fmt.Sprint(p.Key.Nulls), "", "", fmt.Sprint(len(p.Key.Duplicates)), "", "", "", joinCounts(p.Key.Duplicates),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (p *Profile) WriteJson(w io.Writer) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
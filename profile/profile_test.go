@@ -0,0 +1,130 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/goforce/reloader/commons"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+type testRecord map[string]interface{}
+
+func (r testRecord) Get(name string) (interface{}, bool) {
+	v, ok := r[name]
+	return v, ok
+}
+
+func (r testRecord) Set(name string, value interface{}) (interface{}, error) {
+	r[name] = value
+	return value, nil
+}
+
+func (r testRecord) Fields() []string {
+	return nil
+}
+
+type testReader struct {
+	fields  []string
+	records []testRecord
+}
+
+func (r *testReader) Fields() []string {
+	return r.fields
+}
+
+func (r *testReader) Read() (commons.Record, error) {
+	if len(r.records) == 0 {
+		return nil, io.EOF
+	}
+	record := r.records[0]
+	r.records = r.records[1:]
+	return record, nil
+}
+
+func (r *testReader) Location() string {
+	return "test"
+}
+
+func (r *testReader) Close() error {
+	return nil
+}
+
+func testProfile(t *testing.T) *Profile {
+	reader := &testReader{fields: []string{"Code", "Email", "Started", "Amount"}, records: []testRecord{
+		{"Code": "A1", "Email": "a@example.com", "Started": "2019-01-31", "Amount": big.NewRat(5, 1)},
+		{"Code": "A2", "Email": "not an email", "Started": "31.01.2019", "Amount": big.NewRat(5, 2)},
+		{"Code": "A2", "Email": "b@example.com", "Started": " ", "Amount": nil},
+		{"Code": "A3", "Email": nil, "Started": "2019-02-01", "Amount": big.NewRat(5, 1)},
+	}}
+	p, err := Read(reader, []string{"Code"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProfile(t *testing.T) {
+	p := testProfile(t)
+	if p.Records != 4 || len(p.Fields) != 4 {
+		t.Fatal("unexpected profile: ", p)
+	}
+	code := p.Fields[0]
+	if code.Distinct != 3 || code.Duplicates != 1 || code.MinLength != 2 || code.MaxLength != 2 {
+		t.Fatal("unexpected code profile: ", code)
+	}
+	if len(code.Top) != 2 || code.Top[0] != (ValueCount{"A2", 2}) || code.Top[1] != (ValueCount{"A1", 1}) {
+		t.Fatal("unexpected top values: ", code.Top)
+	}
+	email := p.Fields[1]
+	if email.Nulls != 1 || email.Patterns[0] != (ValueCount{"email", 2}) || email.Patterns[1] != (ValueCount{"text", 1}) {
+		t.Fatal("unexpected email profile: ", email)
+	}
+	started := p.Fields[2]
+	if started.Blanks != 1 || started.Patterns[0] != (ValueCount{"date yyyy-mm-dd", 2}) || started.Patterns[1] != (ValueCount{"date dd.mm.yyyy", 1}) {
+		t.Fatal("unexpected started profile: ", started)
+	}
+	if amount := p.Fields[3]; amount.Patterns[0] != (ValueCount{"integer", 2}) || amount.Patterns[1] != (ValueCount{"decimal", 1}) {
+		t.Fatal("unexpected amount profile: ", amount)
+	}
+	if len(p.Key.Duplicates) != 1 || p.Key.Duplicates[0] != (ValueCount{"A2", 2}) {
+		t.Fatal("unexpected key duplicates: ", p.Key.Duplicates)
+	}
+}
+
+func TestProfileKey(t *testing.T) {
+	reader := &testReader{fields: []string{"First", "Last"}, records: []testRecord{
+		{"First": "Ann", "Last": "Lee"},
+		{"First": "Ann", "Last": "Lee"},
+		{"First": nil, "Last": " "},
+		{"First": nil, "Last": nil},
+		{"First": nil, "Last": "Lee"},
+	}}
+	p, err := Read(reader, []string{"first", "Last"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records without key values are not duplicates of each other
+	if p.Key.Nulls != 2 || len(p.Key.Duplicates) != 1 || p.Key.Duplicates[0] != (ValueCount{"Ann|Lee", 2}) {
+		t.Fatal("unexpected key profile: ", p.Key)
+	}
+	if _, err := Read(&testReader{fields: []string{"First", "Last"}}, []string{"Frist"}, 0); err == nil || !strings.Contains(err.Error(), "Frist") {
+		t.Fatal("expected error of unknown key field: ", err)
+	}
+}
+
+func TestWriteCsv(t *testing.T) {
+	var b bytes.Buffer
+	if err := testProfile(t).WriteCsv(&b); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 || rows[1][0] != "Code" || rows[1][9] != "A2:2; A1:1" || rows[5][0] != "key Code" {
+		t.Fatal("unexpected csv: ", rows)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goforce/reloader/commons"
+	"github.com/goforce/reloader/profile"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const PROFILE_USAGE string = "reloader profile --job <label> | --lookup <name> [--key <field,...>] [--top <n>] [--format csv|json] [--out <file>] <config-file.json> [param1 param2 ...]"
+
+type profileOptions struct {
+	job    string
+	lookup string
+	key    []string
+	top    int
+	format string
+	out    string
+}
+
+// parseProfileArgs parses options of profile command, remaining args are config file and its parameters
+func parseProfileArgs(args []string) (*profileOptions, []string, error) {
+	options := &profileOptions{format: "csv"}
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		if len(args) < 2 {
+			return nil, nil, errors.New(fmt.Sprint("value of ", args[0], " should be specified"))
+		}
+		switch args[0] {
+		case "--job":
+			options.job = args[1]
+		case "--lookup":
+			options.lookup = args[1]
+		case "--key":
+			for _, f := range strings.Split(args[1], ",") {
+				if f = strings.TrimSpace(f); f != "" {
+					options.key = append(options.key, f)
+				}
+			}
+		case "--top":
+			top, err := strconv.Atoi(args[1])
+			if err != nil || top <= 0 {
+				return nil, nil, errors.New(fmt.Sprint("--top should be positive number: ", args[1]))
+			}
+			options.top = top
+		case "--format":
+			options.format = strings.ToLower(args[1])
+		case "--out":
+			options.out = args[1]
+		default:
+			return nil, nil, errors.New(fmt.Sprint("unknown option: ", args[0]))
+		}
+		args = args[2:]
+	}
+	if (options.job == "") == (options.lookup == "") {
+		return nil, nil, errors.New("either --job or --lookup should be specified")
+	}
+	if options.format != "csv" && options.format != "json" {
+		return nil, nil, errors.New(fmt.Sprint("unknown format: ", options.format, ", expected csv or json"))
+	}
+	if len(args) == 0 {
+		return nil, nil, errors.New("config file should be specified")
+	}
+	return options, args, nil
+}
+
+// Profile reads all records of source of the job or of the lookup and writes profile of its fields.
+func (config *Config) Profile(options *profileOptions) error {
+	var source commons.Source
+	if options.job != "" {
+		for _, job := range config.Jobs {
+			if job.Label == options.job {
+				if job.Source.Salesforce != nil {
+					source = job.Source.Salesforce
+				} else if job.Source.Csv != nil {
+					source = job.Source.Csv
+				}
+			}
+		}
+		if source == nil {
+			return errors.New(fmt.Sprint("no such job: ", options.job))
+		}
+	} else {
+		lookup, ok := config.Lookups[options.lookup]
+		if !ok {
+			return errors.New(fmt.Sprint("no such lookup: ", options.lookup))
+		}
+		if lookup.Source.Salesforce != nil {
+			source = lookup.Source.Salesforce
+		} else if lookup.Source.Csv != nil {
+			source = lookup.Source.Csv
+		}
+	}
+	reader, err := source.NewReader()
+	if err != nil {
+		return errors.New(fmt.Sprint("error opening source reader: ", err))
+	}
+	defer reader.Close()
+	p, err := profile.Read(reader, options.key, options.top)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if options.out != "" {
+		file, err := os.Create(options.out)
+		if err != nil {
+			return errors.New(fmt.Sprint("cannot create file: ", options.out, "\n", err))
+		}
+		defer file.Close()
+		out = file
+	}
+	if options.format == "json" {
+		return p.WriteJson(out)
+	}
+	return p.WriteCsv(out)
+}
@@ -22,6 +22,10 @@ func main() {
 
 	if len(os.Args) <= 1 {
 		fmt.Println("reloader [--test] <config-file.json> [param1 param2 ...]")
+		fmt.Println("reloader [--test] graph export|import <config-file.json> [param1 param2 ...]")
+		fmt.Println("reloader plan <config-file.json> [param1 param2 ...]")
+		fmt.Println(SCHEMA_DIFF_USAGE)
+		fmt.Println(PROFILE_USAGE)
 	}
 
 	defer func() {
@@ -37,6 +41,39 @@ func main() {
 		args = args[1:]
 	}
 
+	command := ""
+	var diffOptions *schemaDiffOptions
+	var profileOptions *profileOptions
+	if args[0] == "graph" {
+		if len(args) < 3 || (args[1] != "export" && args[1] != "import") {
+			fmt.Println("reloader [--test] graph export|import <config-file.json> [param1 param2 ...]")
+			return
+		}
+		command = args[0] + " " + args[1]
+		args = args[2:]
+	} else if args[0] == "plan" {
+		command = args[0]
+		args = args[1:]
+	} else if args[0] == "schema-diff" {
+		command = args[0]
+		var err error
+		diffOptions, args, err = parseSchemaDiffArgs(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println(SCHEMA_DIFF_USAGE)
+			return
+		}
+	} else if args[0] == "profile" {
+		command = args[0]
+		var err error
+		profileOptions, args, err = parseProfileArgs(args[1:])
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println(PROFILE_USAGE)
+			return
+		}
+	}
+
 	config, errs := ReadConfigFile(args[0], args[1:])
 	if len(errs) > 0 {
 		for _, err := range errs {
@@ -64,6 +101,61 @@ func main() {
 		}
 	}
 
+	switch command {
+	case "graph export":
+		if config.Graph == nil {
+			fmt.Println("graph should be configured")
+			return
+		}
+		if err := config.Graph.Export(); err != nil {
+			fmt.Println(err)
+		}
+		return
+	case "graph import":
+		jobs, err := config.graphJobs()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		config.Jobs = jobs
+		config.SetConfigDefaults()
+	case "profile":
+		if err := config.Profile(profileOptions); err != nil {
+			fmt.Println(err)
+		}
+		return
+	case "schema-diff":
+		if err := config.SchemaDiff(diffOptions); err != nil {
+			fmt.Println(err)
+		}
+		return
+	case "plan":
+		jobs, messages, err := config.Plan()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for i, job := range jobs {
+			fmt.Println(i+1, job.Label)
+		}
+		for _, message := range messages {
+			fmt.Println(message)
+		}
+		return
+	}
+
+	if config.AutoOrder && command == "" {
+		jobs, messages, err := config.Plan()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, message := range messages {
+			log.Println(commons.PROGRESS, message)
+		}
+		config.Jobs = jobs
+	}
+
 	// read in all lookups
 	globalScans := make(map[string]commons.Scan)
 	for name, lkp := range config.Lookups {
@@ -80,7 +172,8 @@ func main() {
 		}
 		globalScans[name] = scan
 	}
-	globals := &Globals{test: config.Test}
+	globals := &Globals{test: config.Test, mappings: config.Mappings}
+	masking := newMaskingFunctions(config.Masking.Salt)
 	globals.functions = func(name string, args []interface{}) (val interface{}, err error) {
 		switch name {
 		case "SCAN":
@@ -113,7 +206,18 @@ func main() {
 				panic(fmt.Sprint("can not cast to boolean: ", reflect.TypeOf(value), " / ", value))
 			}
 		}
-		return nil, eval.NOFUNC{}
+		return masking(name, args)
+	}
+
+	// extract samples before jobs, so jobs could use extracted files
+	if command == "" {
+		for _, sample := range config.Samples {
+			err := sample.Execute()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
 	}
 
 	// execute all jobs
@@ -8,12 +8,23 @@ import (
 	"github.com/goforce/reloader/commons"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 )
 
 const (
+	SKIP_LOG_REASON     string = "skip__Reason"
 	SUCCESS_LOG_CREATED string = "success__Created"
 	SUCCESS_LOG_ID      string = "success__Id"
+	SUCCESS_LOG_DETAILS string = "success__Details"
 	ERROR_LOG_MESSAGE   string = "error__Message"
+	UNMAPPED_LOG_NAME   string = "unmapped__Mapping"
+	UNMAPPED_LOG_VALUE  string = "unmapped__Value"
+	UNMAPPED_LOG_COUNT  string = "unmapped__Count"
+	VIOLATION_CHECK     string = "violation__Check"
+	VIOLATION_SEVERITY  string = "violation__Severity"
+	VIOLATION_MESSAGE   string = "violation__Message"
+	VIOLATION_LOCATION  string = "violation__Location"
 )
 
 type Logs struct {
@@ -23,6 +34,10 @@ type Logs struct {
 	Success Log    `json:"success"`
 	Skip    Log    `json:"skip"`
 	Output  Log    `json:"output"`
+	// values not found in mappings with their frequencies
+	Unmapped Log `json:"unmapped"`
+	// records failing checks of jobs without target
+	Violations Log `json:"violations"`
 }
 
 type Log struct {
@@ -36,12 +51,13 @@ type Reporter interface {
 }
 
 type reporter struct {
-	skipWriter    *writer
-	successWriter *writer
-	errorWriter   *writer
-	fields        []string
-	outputWriter  *writer
-	targetFields  []string
+	skipWriter      *writer
+	successWriter   *writer
+	errorWriter     *writer
+	fields          []string
+	outputWriter    *writer
+	targetFields    []string
+	violationWriter *writer
 }
 
 type report struct {
@@ -56,6 +72,7 @@ type writer struct {
 	initf    func()
 	file     *os.File
 	writer   *csv.Writer
+	lock     sync.Mutex
 }
 
 func NewReporter(def *Logs, defaultPath string, fields []string, targetFields []string) *reporter {
@@ -67,11 +84,11 @@ func NewReporter(def *Logs, defaultPath string, fields []string, targetFields []
 	rr.skipWriter = newWriter(
 		def.Skip,
 		filename(def.Path, def.Skip.Path, defaultPath+"-skip.csv"),
-		rr.fields)
+		append(rr.fields, SKIP_LOG_REASON))
 	rr.successWriter = newWriter(
 		def.Success,
 		filename(def.Path, def.Success.Path, defaultPath+"-success.csv"),
-		append(rr.fields, SUCCESS_LOG_CREATED, SUCCESS_LOG_ID))
+		append(rr.fields, SUCCESS_LOG_CREATED, SUCCESS_LOG_ID, SUCCESS_LOG_DETAILS))
 	rr.errorWriter = newWriter(
 		def.Error,
 		filename(def.Path, def.Error.Path, defaultPath+"-error.csv"),
@@ -80,6 +97,10 @@ func NewReporter(def *Logs, defaultPath string, fields []string, targetFields []
 		def.Output,
 		filename(def.Path, def.Output.Path, defaultPath+"-output.csv"),
 		rr.targetFields)
+	rr.violationWriter = newWriter(
+		def.Violations,
+		filename(def.Path, def.Violations.Path, defaultPath+"-violations.csv"),
+		append(rr.fields, VIOLATION_CHECK, VIOLATION_SEVERITY, VIOLATION_MESSAGE, VIOLATION_LOCATION))
 	return &rr
 }
 
@@ -89,18 +110,20 @@ func (rr *reporter) Close() {
 	rr.successWriter.close()
 	rr.errorWriter.close()
 	rr.outputWriter.close()
+	rr.violationWriter.close()
 }
 
 func (rr *reporter) NewReport(record commons.Record, location string) *report {
 	return &report{reporter: rr, record: record, reported: false, location: location}
 }
 
-func (r *report) Skip() {
-	r.write(r.reporter.skipWriter)
+func (r *report) Skip(reason string) {
+	r.write(r.reporter.skipWriter, reason)
 }
 
-func (r *report) Success(created bool, id string) {
-	r.write(r.reporter.successWriter, fmt.Sprint(created), id)
+// Success reports record written to success log. Optional details are joined into one column.
+func (r *report) Success(created bool, id string, details ...string) {
+	r.write(r.reporter.successWriter, fmt.Sprint(created), id, strings.Join(details, "; "))
 }
 
 // Error reports error to error log. If error log is off then error and location is printed using log topic reloader.errors
@@ -116,6 +139,12 @@ func (r *report) Output(record commons.Record) {
 	r.reporter.outputWriter.write(r.reporter.targetFields, record)
 }
 
+// Violation reports record failing a check to violations log. Record could violate more than one check
+// so violations do not count as reporting of the record.
+func (r *report) Violation(check string, severity string, message string) {
+	r.reporter.violationWriter.write(r.reporter.fields, r.record, check, severity, message, r.location)
+}
+
 func (r *report) write(writer *writer, results ...string) {
 	if r.reported {
 		panic(fmt.Sprint("record reported more than once: ", r.record))
@@ -124,6 +153,19 @@ func (r *report) write(writer *writer, results ...string) {
 	r.reported = true
 }
 
+// WriteUnmapped writes rows of mapping name, value and count to unmapped log. Nothing is written if there are no rows.
+func WriteUnmapped(def *Logs, defaultPath string, rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+	w := newWriter(def.Unmapped, filename(def.Path, def.Unmapped.Path, defaultPath+"-unmapped.csv"),
+		[]string{UNMAPPED_LOG_NAME, UNMAPPED_LOG_VALUE, UNMAPPED_LOG_COUNT})
+	for _, row := range rows {
+		w.write(nil, nil, row...)
+	}
+	w.close()
+}
+
 func filename(dir string, path string, defaultFilename string) string {
 	if path == "" {
 		path = defaultFilename
@@ -157,6 +199,8 @@ func newWriter(def Log, filename string, columns []string) *writer {
 }
 
 func (w *writer) write(fields []string, record commons.Record, results ...string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 	if w.initf != nil {
 		w.initf()
 	}
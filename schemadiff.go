@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/goforce/reloader/force"
+	"io/ioutil"
+	"strings"
+)
+
+const SCHEMA_DIFF_USAGE string = "reloader schema-diff --from <instance> --to <instance> --objects <sObject,...> [--job <label>] [--json <file>] <config-file.json> [param1 param2 ...]"
+
+type schemaDiffOptions struct {
+	from    string
+	to      string
+	objects []string
+	job     string
+	json    string
+}
+
+// parseSchemaDiffArgs parses options of schema-diff command, remaining args are config file and its parameters
+func parseSchemaDiffArgs(args []string) (*schemaDiffOptions, []string, error) {
+	options := &schemaDiffOptions{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		if len(args) < 2 {
+			return nil, nil, errors.New(fmt.Sprint("value of ", args[0], " should be specified"))
+		}
+		switch args[0] {
+		case "--from":
+			options.from = args[1]
+		case "--to":
+			options.to = args[1]
+		case "--objects":
+			for _, o := range strings.Split(args[1], ",") {
+				if o = strings.TrimSpace(o); o != "" {
+					options.objects = append(options.objects, o)
+				}
+			}
+		case "--job":
+			options.job = args[1]
+		case "--json":
+			options.json = args[1]
+		default:
+			return nil, nil, errors.New(fmt.Sprint("unknown option: ", args[0]))
+		}
+		args = args[2:]
+	}
+	if options.from == "" || options.to == "" {
+		return nil, nil, errors.New("both --from and --to instances should be specified")
+	}
+	if len(options.objects) == 0 && options.job == "" {
+		return nil, nil, errors.New("--objects or --job should be specified")
+	}
+	if len(args) == 0 {
+		return nil, nil, errors.New("config file should be specified")
+	}
+	return options, args, nil
+}
+
+// SchemaDiff compares objects of two instances and prints differences, json report is written if requested.
+// Target object of the job is compared too and target fields of the job are checked against it.
+func (config *Config) SchemaDiff(options *schemaDiffOptions) error {
+	objects := options.objects
+	var job *Job
+	var fields []string
+	if options.job != "" {
+		for _, j := range config.Jobs {
+			if j.Label == options.job {
+				job = j
+			}
+		}
+		if job == nil {
+			return errors.New(fmt.Sprint("no such job: ", options.job))
+		}
+		if job.Target.Salesforce == nil {
+			return errors.New(fmt.Sprint("job ", job.Label, " does not write to salesforce"))
+		}
+		compared := false
+		for _, o := range objects {
+			compared = compared || strings.EqualFold(o, job.Target.Salesforce.SObject)
+		}
+		if !compared {
+			objects = append(objects, job.Target.Salesforce.SObject)
+		}
+		for _, rule := range job.Rules {
+			if rule.Target != "" {
+				fields = append(fields, rule.Target)
+			}
+		}
+	}
+	diff, err := force.DiffSchema(options.from, options.to, objects)
+	if err != nil {
+		return err
+	}
+	if options.json != "" {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(options.json, data, 0644); err != nil {
+			return errors.New(fmt.Sprint("error writing schema diff: ", options.json, "\n", err))
+		}
+	}
+	for _, line := range diff.Summary() {
+		fmt.Println(line)
+	}
+	if job != nil {
+		warnings := diff.JobWarnings(job.Target.Salesforce.SObject, fields)
+		if len(warnings) == 0 {
+			fmt.Println("job", job.Label, "has no warnings")
+		} else {
+			fmt.Println("job", job.Label, "warnings:")
+			for _, w := range warnings {
+				fmt.Println("  " + w)
+			}
+		}
+	}
+	return nil
+}